@@ -0,0 +1,83 @@
+package openapi3middleware
+
+import (
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// The outcomes of the validation that the histograms of the body sizes are recorded with as openapi.validation.outcome attribute.
+const (
+	outcomeValid   = "valid"
+	outcomeInvalid = "invalid"
+)
+
+// newBodySizeHistogram returns the histogram of the body sizes named name.
+// It returns the histogram that records nothing if the meter fails to create it.
+func newBodySizeHistogram(opts MiddlewareOptions, name, description string) metric.Int64Histogram {
+	mp := opts.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	h, err := mp.Meter(tracerName).Int64Histogram(name, metric.WithUnit("By"), metric.WithDescription(description))
+	if err != nil {
+		otel.Handle(err)
+		return noop.Int64Histogram{}
+	}
+	return h
+}
+
+func outcomeOf(err error) metric.MeasurementOption {
+	outcome := outcomeValid
+	if err != nil {
+		outcome = outcomeInvalid
+	}
+	return metric.WithAttributes(attribute.String("openapi.validation.outcome", outcome))
+}
+
+// bodyCounter counts the bytes of the request body read in the validation.
+type bodyCounter struct {
+	rc            io.ReadCloser
+	n             int64
+	eof           bool
+	contentLength int64
+}
+
+// countRequestBody replaces the body of the request with the one that counts the bytes read.
+func countRequestBody(r *http.Request) *bodyCounter {
+	c := &bodyCounter{rc: r.Body, contentLength: r.ContentLength}
+	if r.Body == nil || r.Body == http.NoBody {
+		c.eof = true
+		return c
+	}
+	r.Body = c
+	return c
+}
+
+func (c *bodyCounter) Read(p []byte) (int, error) {
+	n, err := c.rc.Read(p)
+	c.n += int64(n)
+	if err == io.EOF {
+		c.eof = true
+	}
+	return n, err
+}
+
+func (c *bodyCounter) Close() error {
+	return c.rc.Close()
+}
+
+// size returns the size of the body if it is known: the body is read to the end or Content-Length is given.
+func (c *bodyCounter) size() (int64, bool) {
+	if c.eof {
+		return c.n, true
+	}
+	if c.contentLength >= 0 {
+		return c.contentLength, true
+	}
+	return 0, false
+}
@@ -0,0 +1,141 @@
+package openapi3middleware
+
+import (
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// coerceScalarParams rewrites the values of the query and path parameters into the form of the scalar type that the parameter schema expects.
+//
+// It is best-effort: the values that cannot be coerced are left as they are and openapi3filter reports them.
+// It returns the function that restores the query and the path parameters so that the next handler receives them as they are sent.
+func coerceScalarParams(input *openapi3filter.RequestValidationInput) func() {
+	noop := func() {}
+	route := input.Route
+	if route == nil {
+		return noop
+	}
+	var params openapi3.Parameters
+	if route.PathItem != nil {
+		params = append(params, route.PathItem.Parameters...)
+	}
+	if route.Operation != nil {
+		params = append(params, route.Operation.Parameters...)
+	}
+	r := input.Request
+	var (
+		originalQuery      = r.URL.RawQuery
+		originalPathParams = input.PathParams
+		pathParams         map[string]string
+		query              = r.URL.Query()
+		queryModified      bool
+	)
+	for _, paramRef := range params {
+		if paramRef == nil || paramRef.Value == nil || paramRef.Value.Schema == nil || paramRef.Value.Schema.Value == nil {
+			continue
+		}
+		param := paramRef.Value
+		schema, separated := scalarSchemaOf(param)
+		if schema == nil {
+			continue
+		}
+		switch param.In {
+		case openapi3.ParameterInQuery:
+			values, ok := query[param.Name]
+			if !ok {
+				continue
+			}
+			for i, value := range values {
+				if coerced := coerceValue(schema, value, separated); coerced != value {
+					values[i] = coerced
+					queryModified = true
+				}
+			}
+		case openapi3.ParameterInPath:
+			value, ok := originalPathParams[param.Name]
+			if !ok {
+				continue
+			}
+			if pathParams == nil {
+				pathParams = make(map[string]string, len(originalPathParams))
+				for name, value := range originalPathParams {
+					pathParams[name] = value
+				}
+			}
+			pathParams[param.Name] = coerceValue(schema, value, separated)
+		}
+	}
+	if queryModified {
+		r.URL.RawQuery = query.Encode()
+	}
+	if pathParams != nil {
+		input.PathParams = pathParams
+	}
+	return func() {
+		r.URL.RawQuery = originalQuery
+		input.PathParams = originalPathParams
+	}
+}
+
+// scalarSchemaOf returns the scalar schema of the parameter or its items, and whether the items are separated by commas.
+func scalarSchemaOf(param *openapi3.Parameter) (*openapi3.Schema, bool) {
+	schema := param.Schema.Value
+	if schema.Type == openapi3.TypeArray {
+		if schema.Items == nil || schema.Items.Value == nil {
+			return nil, false
+		}
+		separated := param.Explode != nil && !*param.Explode
+		if param.In == openapi3.ParameterInPath {
+			separated = true
+		}
+		schema = schema.Items.Value
+		if !isCoercibleType(schema.Type) {
+			return nil, false
+		}
+		return schema, separated
+	}
+	if !isCoercibleType(schema.Type) {
+		return nil, false
+	}
+	return schema, false
+}
+
+func isCoercibleType(typ string) bool {
+	switch typ {
+	case openapi3.TypeBoolean, openapi3.TypeInteger, openapi3.TypeNumber:
+		return true
+	default:
+		return false
+	}
+}
+
+func coerceValue(schema *openapi3.Schema, value string, separated bool) string {
+	if !separated {
+		return coerceScalar(schema.Type, value)
+	}
+	items := strings.Split(value, ",")
+	for i, item := range items {
+		items[i] = coerceScalar(schema.Type, item)
+	}
+	return strings.Join(items, ",")
+}
+
+func coerceScalar(typ string, value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' && value[len(value)-1] == '"' || value[0] == '\'' && value[len(value)-1] == '\'') {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	if typ != openapi3.TypeBoolean {
+		return value
+	}
+	switch strings.ToLower(value) {
+	case "true", "1", "yes", "on", "t", "y":
+		return "true"
+	case "false", "0", "no", "off", "f", "n":
+		return "false"
+	default:
+		return value
+	}
+}
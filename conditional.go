@@ -0,0 +1,41 @@
+package openapi3middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// notModified reports whether the conditional request is satisfied by the ETag of the successful response.
+func notModified(r *http.Request, status int, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if status < 200 || status >= 300 {
+		return false
+	}
+	etag := header.Get("etag")
+	ifNoneMatch := r.Header.Get("if-none-match")
+	if etag == "" || ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || weakETag(candidate) == weakETag(etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// weakETag returns the opaque tag of the entity tag to compare them weakly.
+func weakETag(etag string) string {
+	return strings.TrimPrefix(etag, "W/")
+}
+
+// respondNotModified responds 304 Not Modified without the body and the headers describing the body.
+func respondNotModified(w http.ResponseWriter) {
+	for _, name := range []string{"content-type", "content-length", "content-encoding", "transfer-encoding"} {
+		w.Header().Del(name)
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
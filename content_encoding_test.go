@@ -0,0 +1,57 @@
+package openapi3middleware
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+func TestWithRequestValidation_contentEncoding(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromFile("./testdata/content-encoding.openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedRouter, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "ok", body: base64.StdEncoding.EncodeToString([]byte(`{"name":"aereal"}`)), wantStatus: http.StatusNoContent},
+		{name: "ok without padding", body: base64.RawStdEncoding.EncodeToString([]byte(`{"name":"aereal"}`)), wantStatus: http.StatusNoContent},
+		{name: "invalid after decoding", body: base64.StdEncoding.EncodeToString([]byte(`{"name":17}`)), wantStatus: http.StatusBadRequest},
+		{name: "not encoded", body: `{"name":"aereal"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var received string
+			mw := WithRequestValidation(MiddlewareOptions{Router: encodedRouter})
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				received = string(b)
+				w.WriteHeader(http.StatusNoContent)
+			})))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/uploads", map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusNoContent && received != tc.body {
+				t.Errorf("the handler must receive the body as it is sent: got=%q expected=%q", received, tc.body)
+			}
+		})
+	}
+}
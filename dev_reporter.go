@@ -0,0 +1,133 @@
+package openapi3middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// DevReporter is a reporter that responds the human-readable description of the validation error for local development.
+//
+// Each failure is described with the JSON pointer to the failing field, the reason, the expected constraint, the actual value and the snippet of the schema.
+//
+// It can be used as any of MiddlewareOptions.ReportFindRouteError, MiddlewareOptions.ReportRequestValidationError and MiddlewareOptions.ReportResponseValidationError.
+func DevReporter(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	if requestErr := new(openapi3filter.RequestError); errors.As(err, &requestErr) {
+		status = http.StatusBadRequest
+	}
+	w.Header().Set("content-type", "text/plain; charset=utf-8")
+	w.Header().Del("content-encoding")
+	w.Header().Del("content-length")
+	w.WriteHeader(status)
+	writeDevReport(w, r, err, false)
+}
+
+// NewDevReporter returns DevReporter that also writes the description to console, such as os.Stderr.
+// The description written to console is colorized only if console is a terminal.
+func NewDevReporter(console io.Writer) func(w http.ResponseWriter, r *http.Request, err error) {
+	color := isTerminal(console)
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		writeDevReport(console, r, err, color)
+		DevReporter(w, r, err)
+	}
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiFaint  = "\x1b[2m"
+)
+
+func writeDevReport(out io.Writer, r *http.Request, err error, color bool) {
+	paint := func(code, s string) string {
+		if !color {
+			return s
+		}
+		return code + s + ansiReset
+	}
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "%s %s %s\n", paint(ansiBold+ansiRed, "validation failed:"), r.Method, r.URL.Path)
+	walkValidationErrors(err, func(failure validationFailure) {
+		pointer := failure.field()
+		if pointer == "" {
+			pointer = "/"
+		}
+		fmt.Fprintf(b, "  at %s\n", paint(ansiYellow, pointer))
+		fmt.Fprintf(b, "    reason:   %s\n", failure.reason)
+		schemaErr, ok := failure.schemaError()
+		if !ok {
+			return
+		}
+		if expected := expectedConstraint(schemaErr); expected != "" {
+			fmt.Fprintf(b, "    expected: %s\n", expected)
+		}
+		fmt.Fprintf(b, "    actual:   %s\n", compactJSON(schemaErr.Value))
+		if schemaErr.Schema != nil {
+			fmt.Fprintf(b, "    schema:\n%s\n", paint(ansiFaint, indentJSON(schemaErr.Schema, "      ")))
+		}
+	})
+	_, _ = io.WriteString(out, b.String())
+}
+
+// expectedConstraint returns the constraint of the schema that the value violates.
+func expectedConstraint(schemaErr *openapi3.SchemaError) string {
+	if schemaErr.Schema == nil || schemaErr.SchemaField == "" {
+		return ""
+	}
+	encoded, err := json.Marshal(schemaErr.Schema)
+	if err != nil {
+		return ""
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &members); err != nil {
+		return ""
+	}
+	constraint, ok := members[schemaErr.SchemaField]
+	if !ok {
+		return schemaErr.SchemaField
+	}
+	return fmt.Sprintf("%s %s", schemaErr.SchemaField, constraint)
+}
+
+func compactJSON(v interface{}) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(encoded)
+}
+
+func indentJSON(v interface{}, prefix string) string {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return prefix + fmt.Sprintf("%v", v)
+	}
+	buf := new(bytes.Buffer)
+	if err := json.Indent(buf, encoded, prefix, "  "); err != nil {
+		return prefix + string(encoded)
+	}
+	return prefix + buf.String()
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
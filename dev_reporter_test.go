@@ -0,0 +1,43 @@
+package openapi3middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDevReporter(t *testing.T) {
+	console := new(bytes.Buffer)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	mw := WithRequestValidation(MiddlewareOptions{Router: router, ReportRequestValidationError: NewDevReporter(console)})
+	srv := httptest.NewServer(mw(handler))
+	defer srv.Close()
+	resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, `{"name":"aereal","age":"abc"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, http.StatusBadRequest)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"at /age", `expected: type "integer"`, `actual:   "abc"`, "schema:"} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(string(body), "\x1b[") {
+		t.Errorf("body must not be colorized:\n%s", body)
+	}
+	if console.String() != string(body) {
+		t.Errorf("console output differs from body:\n%s", console.String())
+	}
+}
@@ -0,0 +1,80 @@
+package openapi3middleware
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// selectRequestBodyByHeader replaces the route of input with the one whose request body schema is selected by the value of the header.
+//
+// It selects one of oneOf schemas that have a discriminator: the mapping of the discriminator maps the header values to the schemas,
+// and the name of the referenced schema is used if the mapping does not have the value.
+// The request bodies without such schemas are left as they are.
+func selectRequestBodyByHeader(input *openapi3filter.RequestValidationInput, header string) error {
+	op := input.Route.Operation
+	if op == nil || op.RequestBody == nil || op.RequestBody.Value == nil {
+		return nil
+	}
+	requestBody := op.RequestBody.Value
+	var content openapi3.Content
+	for mediaType, mt := range requestBody.Content {
+		if mt == nil || mt.Schema == nil || mt.Schema.Value == nil {
+			continue
+		}
+		schema := mt.Schema.Value
+		if schema.Discriminator == nil || len(schema.OneOf) == 0 {
+			continue
+		}
+		value := input.Request.Header.Get(header)
+		selected := selectOneOfSchema(schema, value)
+		if selected == nil {
+			return &openapi3filter.RequestError{
+				Input:       input,
+				RequestBody: requestBody,
+				Reason:      fmt.Sprintf("header %q has the value %q that does not select any schema", header, value),
+			}
+		}
+		if content == nil {
+			content = make(openapi3.Content, len(requestBody.Content))
+			for k, v := range requestBody.Content {
+				content[k] = v
+			}
+		}
+		replaced := *mt
+		replaced.Schema = selected
+		content[mediaType] = &replaced
+	}
+	if content == nil {
+		return nil
+	}
+	replacedBody := *requestBody
+	replacedBody.Content = content
+	replacedOp := *op
+	replacedOp.RequestBody = &openapi3.RequestBodyRef{Value: &replacedBody}
+	replacedRoute := *input.Route
+	replacedRoute.Operation = &replacedOp
+	input.Route = &replacedRoute
+	return nil
+}
+
+func selectOneOfSchema(schema *openapi3.Schema, value string) *openapi3.SchemaRef {
+	if value == "" {
+		return nil
+	}
+	ref := schema.Discriminator.Mapping[value]
+	for _, candidate := range schema.OneOf {
+		if ref != "" {
+			if candidate.Ref == ref {
+				return candidate
+			}
+			continue
+		}
+		if candidate.Ref != "" && candidate.Ref[strings.LastIndex(candidate.Ref, "/")+1:] == value {
+			return candidate
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package openapi3middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+// ValidateAgainstExample returns an error unless the JSON body conforms to the schema of the response of the route and equals the named example of it.
+//
+// The example is looked up among the media types of the response in the order of their names.
+// It is intended to be used in the contract tests of the handlers.
+func ValidateAgainstExample(route *routers.Route, status int, exampleName string, body []byte) error {
+	if route == nil || route.Operation == nil || route.Operation.Responses == nil {
+		return fmt.Errorf("the route has no responses")
+	}
+	responses := route.Operation.Responses
+	responseRef := responses.Status(status)
+	if responseRef == nil {
+		responseRef = responses.Default()
+	}
+	if responseRef == nil || responseRef.Value == nil {
+		return fmt.Errorf("the response of status %d is not declared", status)
+	}
+	mt, example := findNamedExample(responseRef.Value.Content, exampleName)
+	if example == nil {
+		return fmt.Errorf("the example %q is not declared in the response of status %d", exampleName, status)
+	}
+	var got interface{}
+	if err := json.Unmarshal(body, &got); err != nil {
+		return fmt.Errorf("failed to decode the body: %w", err)
+	}
+	if mt.Schema != nil && mt.Schema.Value != nil {
+		if err := mt.Schema.Value.VisitJSON(got, openapi3.MultiErrors()); err != nil {
+			return err
+		}
+	}
+	want, err := normalizeJSON(example.Value)
+	if err != nil {
+		return fmt.Errorf("failed to encode the example %q: %w", exampleName, err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		encoded, _ := json.Marshal(want)
+		return fmt.Errorf("the body does not equal the example %q: got=%s expected=%s", exampleName, body, encoded)
+	}
+	return nil
+}
+
+func findNamedExample(content openapi3.Content, name string) (*openapi3.MediaType, *openapi3.Example) {
+	mediaTypes := make([]string, 0, len(content))
+	for mediaType := range content {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	sort.Strings(mediaTypes)
+	for _, mediaType := range mediaTypes {
+		mt := content[mediaType]
+		if mt == nil {
+			continue
+		}
+		if ex := mt.Examples[name]; ex != nil && ex.Value != nil {
+			return mt, ex.Value
+		}
+	}
+	return nil, nil
+}
+
+// normalizeJSON returns the value as it is decoded from JSON so that it can be compared with the decoded body.
+func normalizeJSON(v interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(encoded, &normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
@@ -0,0 +1,38 @@
+package openapi3middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestValidateAgainstExample(t *testing.T) {
+	route, _, err := router.FindRoute(mustRequest(http.NewRequest(http.MethodGet, "/featured-user", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name        string
+		response    interface{}
+		exampleName string
+		wantErr     bool
+	}{
+		{name: "equals the example", response: user{ID: "123", Name: "aereal", Age: 17}, exampleName: "aereal", wantErr: false},
+		{name: "differs from the example", response: user{ID: "123", Name: "aereal", Age: 18}, exampleName: "aereal", wantErr: true},
+		{name: "does not conform to the schema", response: map[string]interface{}{"id": "123", "name": "aereal"}, exampleName: "aereal", wantErr: true},
+		{name: "undeclared example", response: user{ID: "123", Name: "aereal", Age: 17}, exampleName: "unknown", wantErr: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(tc.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = ValidateAgainstExample(route, http.StatusOK, tc.exampleName, body)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("error: got=%v wantErr=%t", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package openapi3middleware
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// validationFailure is a leaf of the tree of the validation errors.
+type validationFailure struct {
+	// param is the parameter that the failure belongs to, if any.
+	param *openapi3.Parameter
+	// err is the cause of the failure.
+	// It is nil if the failure is RequestError or ResponseError without its cause.
+	err error
+	// reason describes the failure.
+	reason string
+}
+
+// schemaError returns the SchemaError that causes the failure, if any.
+func (f validationFailure) schemaError() (*openapi3.SchemaError, bool) {
+	schemaErr, ok := f.err.(*openapi3.SchemaError)
+	return schemaErr, ok
+}
+
+// field returns the name of the failing parameter followed by the JSON pointer to the failing value in it,
+// or the JSON pointer to the failing value of the body.
+func (f validationFailure) field() string {
+	name := parameterName(f.param)
+	if schemaErr, ok := f.schemaError(); ok {
+		return name + toJSONPointer(schemaErr.JSONPointer())
+	}
+	return name
+}
+
+// walkValidationErrors calls visit with every failure contained in err in order.
+func walkValidationErrors(err error, visit func(failure validationFailure)) {
+	walkFailures(err, nil, visit)
+}
+
+func walkFailures(err error, param *openapi3.Parameter, visit func(failure validationFailure)) {
+	switch err := err.(type) {
+	case openapi3.MultiError:
+		for _, child := range err {
+			walkFailures(child, param, visit)
+		}
+	case *openapi3filter.RequestError:
+		if err.Err == nil {
+			visit(validationFailure{param: err.Parameter, reason: err.Reason})
+			return
+		}
+		walkFailures(err.Err, err.Parameter, visit)
+	case *openapi3filter.ResponseError:
+		if err.Err == nil {
+			visit(validationFailure{reason: err.Reason})
+			return
+		}
+		walkFailures(err.Err, nil, visit)
+	case *openapi3.SchemaError:
+		visit(validationFailure{param: param, err: err, reason: err.Reason})
+	default:
+		visit(validationFailure{param: param, err: err, reason: err.Error()})
+	}
+}
@@ -0,0 +1,51 @@
+package openapi3middleware
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// FromFS loads the document at name in fsys and returns a middleware that validates against both request and response with it.
+//
+// The relative references in the document are resolved within fsys, so that the document embedded with embed.FS can be used without file access at runtime.
+// If options.Router is nil, the router built with gorillamux that matches the servers of the document is used.
+func FromFS(fsys fs.FS, name string, options MiddlewareOptions) (Middleware, error) {
+	return FromFSWithServerMatchMode(fsys, name, MatchServers, options)
+}
+
+// FromFSWithServerMatchMode is the variant of FromFS that builds the router matching the servers in mode if options.Router is nil.
+func FromFSWithServerMatchMode(fsys fs.FS, name string, mode ServerMatchMode, options MiddlewareOptions) (Middleware, error) {
+	doc, err := LoadFromFS(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if options.Router == nil {
+		options.Router, err = NewRouter(doc, mode)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return WithValidation(options), nil
+}
+
+// LoadFromFS loads the document at name in fsys, resolving the relative references within fsys.
+func LoadFromFS(fsys fs.FS, name string) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+	loader.ReadFromURIFunc = func(_ *openapi3.Loader, location *url.URL) ([]byte, error) {
+		if location.Scheme != "" || location.Host != "" {
+			return nil, fmt.Errorf("cannot read %s outside the filesystem", location)
+		}
+		return fs.ReadFile(fsys, strings.TrimPrefix(path.Clean(location.Path), "/"))
+	}
+	doc, err := loader.LoadFromFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("LoadFromFile: %w", err)
+	}
+	return doc, nil
+}
@@ -0,0 +1,66 @@
+package openapi3middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+var specFS = fstest.MapFS{
+	"spec/openapi.json": &fstest.MapFile{Data: []byte(`{
+  "openapi": "3.0.3",
+  "info": {"title": "user account service", "version": "1.0.0"},
+  "paths": {
+    "/users": {
+      "post": {
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"$ref": "./schemas/user.json"}}}
+        },
+        "responses": {"200": {"description": "ok"}}
+      }
+    }
+  }
+}`)},
+	"spec/schemas/user.json": &fstest.MapFile{Data: []byte(`{
+  "type": "object",
+  "properties": {"name": {"type": "string"}, "age": {"type": "integer"}},
+  "required": ["name", "age"]
+}`)},
+}
+
+func TestFromFS(t *testing.T) {
+	if _, err := FromFS(specFS, "spec/unknown.json", MiddlewareOptions{}); err == nil {
+		t.Error("expected an error for the missing document")
+	}
+	mw, err := FromFS(specFS, "spec/openapi.json", MiddlewareOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "ok", body: `{"name":"aereal","age":17}`, wantStatus: http.StatusOK},
+		{name: "request error", body: `{"name":"aereal","age":"abc"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
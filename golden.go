@@ -0,0 +1,131 @@
+package openapi3middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+// GoldenValidator validates recorded responses against the spec and compares them with golden files.
+//
+// It is intended to be used in the tests of handlers.
+type GoldenValidator struct {
+	Router            routers.Router
+	ValidationOptions *openapi3filter.Options
+	// Dir is the directory that golden files are stored in.
+	Dir string
+	// Update makes Validate overwrite golden files with the given responses instead of comparing with them.
+	// It is typically bound to a command line flag such as -update.
+	Update bool
+}
+
+// Validate validates the response to the request against the spec, and compares it with the golden file named name.
+//
+// If the golden file does not exist or Update is true, it writes the response to the golden file.
+// The Date header is not compared.
+func (v *GoldenValidator) Validate(ctx context.Context, name string, req *http.Request, resp *http.Response) error {
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	route, pathParams, err := v.Router.FindRoute(req)
+	if err != nil {
+		return fmt.Errorf("FindRoute: %w", err)
+	}
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: &openapi3filter.RequestValidationInput{
+			Request:    req,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    v.ValidationOptions,
+		},
+		Status:  resp.StatusCode,
+		Header:  resp.Header,
+		Options: v.ValidationOptions,
+	}
+	input.SetBodyBytes(body)
+	if err := openapi3filter.ValidateResponse(ctx, input); err != nil {
+		return err
+	}
+	path := goldenResponsePath(v.Dir, name)
+	if !v.Update {
+		golden, err := readGoldenResponse(path)
+		if err == nil {
+			return compareResponse(golden, resp)
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return writeGoldenResponse(path, resp)
+}
+
+func goldenResponsePath(dir, name string) string {
+	return filepath.Join(dir, url.QueryEscape(name))
+}
+
+func readGoldenResponse(path string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), nil)
+}
+
+func writeGoldenResponse(path string, resp *http.Response) error {
+	dumped, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return fmt.Errorf("DumpResponse: %w", err)
+	}
+	return os.WriteFile(path, dumped, 0644)
+}
+
+// compareResponse compares the status code, the body, and the headers except Date of got with expected.
+func compareResponse(expected, got *http.Response) error {
+	if got.StatusCode != expected.StatusCode {
+		return fmt.Errorf("StatusCode: got=%d expected=%d", got.StatusCode, expected.StatusCode)
+	}
+	expectedBody, _ := io.ReadAll(expected.Body)
+	gotBody, _ := io.ReadAll(got.Body)
+	defer func() {
+		// rewind body
+		expected.Body = io.NopCloser(bytes.NewReader(expectedBody))
+		got.Body = io.NopCloser(bytes.NewReader(gotBody))
+	}()
+	if string(expectedBody) != string(gotBody) {
+		return fmt.Errorf("body:\ngot=%s\nexpected=%s", gotBody, expectedBody)
+	}
+	if err := compareHTTPHeader(expected.Header, got.Header); err != nil {
+		return err
+	}
+	return nil
+}
+
+func compareHTTPHeader(expected, got http.Header) error {
+	excludes := map[string]bool{"Date": true}
+	expectedBuf := new(bytes.Buffer)
+	gotBuf := new(bytes.Buffer)
+	if err := expected.WriteSubset(expectedBuf, excludes); err != nil {
+		return err
+	}
+	if err := got.WriteSubset(gotBuf, excludes); err != nil {
+		return err
+	}
+	if expectedBuf.String() != gotBuf.String() {
+		return fmt.Errorf("got=%q expected=%q", gotBuf.String(), expectedBuf.String())
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package openapi3middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestGoldenValidator(t *testing.T) {
+	testCases := []struct {
+		name        string
+		update      bool
+		recorded    interface{}
+		body        interface{}
+		wantErr     bool
+		wantUpdated bool
+	}{
+		{
+			name:    "ok/golden file created",
+			body:    user{Name: "aereal", Age: 17, ID: "123"},
+			wantErr: false,
+		},
+		{
+			name:     "ok/same as golden file",
+			recorded: user{Name: "aereal", Age: 17, ID: "123"},
+			body:     user{Name: "aereal", Age: 17, ID: "123"},
+			wantErr:  false,
+		},
+		{
+			name:     "ng/differs from golden file",
+			recorded: user{Name: "aereal", Age: 17, ID: "123"},
+			body:     user{Name: "aereal", Age: 18, ID: "123"},
+			wantErr:  true,
+		},
+		{
+			name:        "ok/differs from golden file but updated",
+			update:      true,
+			recorded:    user{Name: "aereal", Age: 17, ID: "123"},
+			body:        user{Name: "aereal", Age: 18, ID: "123"},
+			wantErr:     false,
+			wantUpdated: true,
+		},
+		{
+			name:    "ng/response does not conform to the spec",
+			update:  true,
+			body:    map[string]interface{}{"name": "aereal", "age": 17},
+			wantErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			body := tc.recorded
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(body)
+			}))
+			defer srv.Close()
+			do := func() (*http.Request, *http.Response) {
+				req := mustRequest(newRequest(http.MethodGet, srv.URL+"/users/123", map[string]string{}, ""))
+				resp, err := srv.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return req, resp
+			}
+			if tc.recorded != nil {
+				req, resp := do()
+				if err := (&GoldenValidator{Router: router, Dir: dir}).Validate(ctx, "user", req, resp); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			body = tc.body
+			v := &GoldenValidator{Router: router, Dir: dir, Update: tc.update}
+			req, resp := do()
+			err := v.Validate(ctx, "user", req, resp)
+			if gotErr := err != nil; gotErr != tc.wantErr {
+				t.Errorf("error: got=%v wantErr=%t", err, tc.wantErr)
+			}
+			if tc.wantUpdated {
+				golden, err := readGoldenResponse(goldenResponsePath(dir, "user"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got user
+				if err := json.NewDecoder(golden.Body).Decode(&got); err != nil {
+					t.Fatal(err)
+				}
+				if want := tc.body.(user); got != want {
+					t.Errorf("golden file:\ngot=%#v\nexpected=%#v", got, want)
+				}
+			}
+			if !tc.wantErr {
+				if _, err := os.Stat(goldenResponsePath(dir, "user")); err != nil {
+					t.Errorf("golden file: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package openapi3middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// overridableMethods are the methods that MethodOverrideHeader can override POST with.
+// The safe methods such as GET and the ones that change the semantics of the connection such as CONNECT are excluded,
+// so that the overridden requests are not exempted from the checks for the unsafe methods such as CSRF protection.
+var overridableMethods = map[string]bool{
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// overrideMethod returns the copy of r whose method is replaced with the value of MethodOverrideHeader, and whether it is replaced.
+// Only POST requests are overridden as the clients that cannot send the other methods tunnel them through POST.
+func (o MiddlewareOptions) overrideMethod(r *http.Request) (*http.Request, bool) {
+	if o.MethodOverrideHeader == "" || r.Method != http.MethodPost {
+		return r, false
+	}
+	method := strings.ToUpper(strings.TrimSpace(r.Header.Get(o.MethodOverrideHeader)))
+	if !overridableMethods[method] {
+		return r, false
+	}
+	overridden := r.WithContext(r.Context())
+	overridden.Method = method
+	return overridden, true
+}
+
+func recordMethodOverride(span trace.Span, r *http.Request) {
+	span.SetAttributes(
+		attribute.String("http.request.method", r.Method),
+		attribute.String("http.request.method_original", http.MethodPost),
+	)
+}
@@ -1,20 +1,31 @@
 package openapi3middleware
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/getkin/kin-openapi/routers"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
-type middleware = func(next http.Handler) http.Handler
+// Middleware is a function that wraps http.Handler.
+type Middleware = func(next http.Handler) http.Handler
 
 type MiddlewareOptions struct {
 	Router                        routers.Router
@@ -23,6 +34,140 @@ type MiddlewareOptions struct {
 	ReportRequestValidationError  func(w http.ResponseWriter, r *http.Request, err error)
 	ReportResponseValidationError func(w http.ResponseWriter, r *http.Request, err error)
 	TracerProvider                trace.TracerProvider
+	// MeterProvider is the provider of the histograms of the request and response body sizes.
+	// The global MeterProvider is used if it is nil.
+	MeterProvider metric.MeterProvider
+	// ResponseSpillThreshold is the size in bytes of the buffered response body above which
+	// WithResponseValidation moves the body to a temporary file instead of holding it on memory.
+	// Zero or negative value means the whole body is always buffered on memory.
+	ResponseSpillThreshold int64
+	// TreatNullAsAbsent makes WithRequestValidation remove null values from JSON request bodies before validation,
+	// so that the properties with null are treated as if they are omitted.
+	//
+	// It is intended for legacy clients that send null for optional properties that are not nullable.
+	// Note that the next handler also receives the body without null values,
+	// and null values for required properties are reported as missing rather than type mismatches.
+	TreatNullAsAbsent bool
+	// ResponseMode is the default ValidationMode of response validation.
+	// It can be overridden for each request by WithResponseMode.
+	ResponseMode ValidationMode
+	// RequestMode is the default ValidationMode of request validation.
+	// It can be overridden for each request by WithRequestMode.
+	// The failures observed in Observe mode are delivered to AsyncErrorSink together with the result of the response validation if it follows.
+	RequestMode ValidationMode
+	// MaxReportedErrors is the maximum number of the reports that the default reporters emit
+	// when openapi3filter.Options.MultiError is enabled and the validation produces multiple errors.
+	// Zero or negative value means unlimited.
+	MaxReportedErrors int
+	// ErrorExtraFunc returns the members that the default reporters add to the top-level object of error responses,
+	// such as the name of the service.
+	// The members that collide with the ones of the error responses are ignored.
+	ErrorExtraFunc func(r *http.Request) map[string]interface{}
+	// ConcurrentValidation makes WithRequestValidation validate the request body concurrently with the other parts of the request,
+	// so that the validation of parameters proceeds while the body is being read.
+	//
+	// If both of them fail, the errors are combined into openapi3.MultiError when openapi3filter.Options.MultiError is enabled,
+	// otherwise the error of the parameters is reported.
+	// It pays off only if reading the body takes time such as large bodies from slow clients;
+	// otherwise the overhead of copying the request and starting a goroutine dominates.
+	ConcurrentValidation bool
+	// ResponseWriterFactory returns the BufferingResponseWriter that WithResponseValidation passes to the handler.
+	// It lets the writers of other instrumentation such as access logs cooperate with the validation.
+	// ResponseSpillThreshold is ignored if it is set.
+	ResponseWriterFactory func(w http.ResponseWriter) BufferingResponseWriter
+	// EnableResponseValidation controls whether WithValidation validates responses.
+	// If it points false, WithValidation validates only requests and responses are streamed without buffering.
+	// nil means true.
+	EnableResponseValidation *bool
+	// AsyncErrorSink receives every validation failure in the background, independent of the error responses.
+	// The caller is responsible for shutting it down.
+	AsyncErrorSink *ErrorSink
+	// DiscriminatorHeader is the name of the header that selects the request body schema among oneOf schemas with a discriminator.
+	// The mapping of the discriminator maps the header values to the schemas,
+	// and the name of the referenced schema is used if the mapping does not have the value.
+	DiscriminatorHeader string
+	// GrpcStatusTrailer is the name of the trailer that conveys the effective status of the response.
+	// If it is set and the handler sets the trailer to the valid status code, the response is validated as the one of the status.
+	GrpcStatusTrailer string
+	// Debug makes the middleware record the openapi3filter.Options used for the validation as the span event.
+	Debug bool
+	// HandleConditionalRequests makes the middleware respond 304 Not Modified without the body
+	// if the ETag of the successful response matches If-None-Match of the GET or HEAD request.
+	// The body of such responses is not validated.
+	HandleConditionalRequests bool
+	// ForbidUndeclaredResponseHeaders makes the middleware report the response that has headers not declared in the spec.
+	// The headers that the servers and the proxies commonly set such as Content-Type and Date are allowed.
+	ForbidUndeclaredResponseHeaders bool
+	// AllowedUndeclaredResponseHeaders is the list of the additional headers that ForbidUndeclaredResponseHeaders allows.
+	AllowedUndeclaredResponseHeaders []string
+	// CoerceScalars makes the middleware coerce the values of the query and path parameters into the scalar type that the parameter schema expects before the validation.
+	// For example, "yes" and "1" become true for boolean parameters and the quoted "5" becomes 5 for integer parameters.
+	// The next handler receives the parameters as they are sent.
+	CoerceScalars bool
+	// ValidateResponseStatuses reports whether the response of the status is validated.
+	// The responses of the other statuses are sent directly without being buffered.
+	// Every response is validated if it is nil. See also Only2xx.
+	ValidateResponseStatuses func(status int) bool
+	// ContentTypeAliases maps the media types of the requests to the ones that the requests are validated as.
+	// For example, {"text/plain": "application/json"} validates the JSON sent as text/plain by legacy clients against the JSON schema.
+	// The next handler receives the request with the original Content-Type.
+	ContentTypeAliases map[string]string
+	// ParameterMapper returns the values of the parameters that the request carries outside their canonical locations such as the custom headers of gateways.
+	// The values are set to the parameters declared with the names only for the validation, overriding the values in the request.
+	ParameterMapper func(r *http.Request) map[string]string
+	// PostTransform rewrites the response body before it is validated and sent.
+	// It receives the whole body that the next handler, including the inner middlewares, has written, such as the body compressed by them.
+	// The body is not decoded according to Content-Encoding, so the returned body must be encoded in the same way.
+	// The successful response is sent with Content-Length of the returned body.
+	PostTransform func(body []byte) []byte
+	// StrictNumbers makes the middleware report the integers in the JSON request body that overflow the formats (int32 and int64) declared in the schema,
+	// including the ones that lose precision as float64.
+	StrictNumbers bool
+	// OnValidationSkipped is called with the reason whenever the validation is deliberately bypassed for the request,
+	// such as the auditing of the bypassed requests.
+	// The reasons are the constants prefixed with SkipReason, and the bypasses not listed there such as Observe mode are not reported.
+	OnValidationSkipped func(r *http.Request, reason string)
+	// MethodOverrideHeader is the name of the header such as X-HTTP-Method-Override that overrides the method of POST requests.
+	// Only PUT, PATCH and DELETE can override POST; the other values are ignored.
+	// If it is set, the request is routed and validated as the one of the overriding method,
+	// and the next handler also receives the request with the overriding method.
+	MethodOverrideHeader string
+}
+
+func (o MiddlewareOptions) sendToSink(ctx context.Context, r *http.Request, phase ValidationPhase, route *routers.Route, err error) {
+	o.send(ctx, ValidationResult{Phase: phase, Method: r.Method, Path: r.URL.Path, Route: route, Err: err})
+}
+
+func (o MiddlewareOptions) send(ctx context.Context, result ValidationResult) {
+	if o.AsyncErrorSink == nil {
+		return
+	}
+	o.AsyncErrorSink.Send(ctx, result)
+}
+
+func (o MiddlewareOptions) responseValidationEnabled() bool {
+	return o.EnableResponseValidation == nil || *o.EnableResponseValidation
+}
+
+func (o MiddlewareOptions) newBufferingResponseWriter(w http.ResponseWriter) BufferingResponseWriter {
+	if f := o.ResponseWriterFactory; f != nil {
+		return f(w)
+	}
+	return newBufferingResponseWriter(w, o.ResponseSpillThreshold)
+}
+
+func (o MiddlewareOptions) requestMode(ctx context.Context) ValidationMode {
+	if mode, ok := requestModeFromContext(ctx); ok {
+		return mode
+	}
+	return o.RequestMode
+}
+
+func (o MiddlewareOptions) responseMode(ctx context.Context) ValidationMode {
+	if mode, ok := responseModeFromContext(ctx); ok {
+		return mode
+	}
+	return o.ResponseMode
 }
 
 func (o MiddlewareOptions) reportFindRouteError(w http.ResponseWriter, r *http.Request, err error) {
@@ -30,7 +175,7 @@ func (o MiddlewareOptions) reportFindRouteError(w http.ResponseWriter, r *http.R
 		f(w, r, err)
 		return
 	}
-	defaultReportFindRouteError(w, err)
+	defaultReportFindRouteError(w, err, o.errorExtra(r))
 }
 
 func (o MiddlewareOptions) reportReqError(w http.ResponseWriter, r *http.Request, err error) {
@@ -38,7 +183,7 @@ func (o MiddlewareOptions) reportReqError(w http.ResponseWriter, r *http.Request
 		f(w, r, err)
 		return
 	}
-	defaultReportRequestError(w, err)
+	defaultReportRequestError(w, err, o.MaxReportedErrors, o.errorExtra(r))
 }
 
 func (o MiddlewareOptions) reportRespError(w http.ResponseWriter, r *http.Request, err error) {
@@ -46,32 +191,125 @@ func (o MiddlewareOptions) reportRespError(w http.ResponseWriter, r *http.Reques
 		f(w, r, err)
 		return
 	}
-	defaultReportResponseError(w, err)
+	defaultReportResponseError(w, err, o.MaxReportedErrors, o.errorExtra(r))
+}
+
+func (o MiddlewareOptions) errorExtra(r *http.Request) map[string]interface{} {
+	if f := o.ErrorExtraFunc; f != nil {
+		return f(r)
+	}
+	return nil
 }
 
 // WithValidation returns a middleware that validates against both request and response.
-func WithValidation(options MiddlewareOptions) middleware {
+// It validates only requests if MiddlewareOptions.EnableResponseValidation points false.
+//
+// The route found by a layer is reused by the other layer for the same request,
+// so the combination of WithRequestValidation and WithResponseValidation finds the route only once as well.
+func WithValidation(options MiddlewareOptions) Middleware {
 	req := WithRequestValidation(options)
+	if !options.responseValidationEnabled() {
+		return func(next http.Handler) http.Handler {
+			return req(options.notifyingSkipped(next, SkipReasonResponseValidationDisabled))
+		}
+	}
 	resp := WithResponseValidation(options)
 	return func(next http.Handler) http.Handler {
 		return req(resp(next))
 	}
 }
 
+// OnlyUnder returns a middleware that applies mw only to the requests whose path is under prefix.
+// The other requests are passed to the next handler directly.
+//
+// If mw is built by this package such as WithValidation, its MiddlewareOptions.OnValidationSkipped is notified of the other requests.
+func OnlyUnder(prefix string, mw Middleware) Middleware {
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	return func(next http.Handler) http.Handler {
+		wrapped := mw(next)
+		outside := next
+		if notifier, ok := wrapped.(skipNotifier); ok {
+			outside = notifier.notifyingSkipped(next, SkipReasonPath)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if path := r.URL.Path; path == prefix || strings.HasPrefix(path, dir) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			outside.ServeHTTP(w, r)
+		})
+	}
+}
+
 // WithResponseValidation returns a middleware that validates against response.
 // It may consume larger memory because it holds entire response body to validate it later.
-func WithResponseValidation(options MiddlewareOptions) middleware {
+// Set MiddlewareOptions.ResponseSpillThreshold to hold large bodies in a temporary file instead.
+// The body compressed with gzip (Content-Encoding: gzip) is decompressed to validate, and sent to the client as it is.
+// Flushing in the handler (e.g. with http.ResponseController) is deferred until the response is validated.
+// If the handler hijacks the connection, the response written so far is sent and the validation is given up.
+// A panic in the validation caused by the malformed spec is reported as a response validation error.
+// Set MiddlewareOptions.ValidateResponseStatuses to send the responses of the other statuses without buffering them.
+// The size of the buffered response body is recorded as openapi.response.body_size attribute of the span,
+// and as openapi.response.body_size histogram with the outcome of the validation unless the validation is skipped.
+func WithResponseValidation(options MiddlewareOptions) Middleware {
+	bodySizes := newBodySizeHistogram(options, "openapi.response.body_size", "The size of the validated response body.")
 	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		return options.validatingHandler(func(w http.ResponseWriter, r *http.Request) {
+			r, overridden := options.overrideMethod(r)
 			ctx := r.Context()
 			ctx, span := getTracer(ctx, options).Start(ctx, "ResponseValidation")
 			defer span.End()
-			irw := newBufferingResponseWriter(w)
-			next.ServeHTTP(irw, r.WithContext(ctx))
+			if overridden {
+				recordMethodOverride(span, r)
+			}
+			ctx = withRouteCache(ctx)
+			ctx = withObservation(ctx)
+			r = r.WithContext(ctx)
+			obs := observationFromContext(ctx)
+			obs.responsePending = true
+			defer func() {
+				// deliver the failure of the request validation observed alone if the response is not reported with it
+				if result := obs.takeRequest(); result != nil {
+					options.send(ctx, *result)
+				}
+			}()
+			// resolve the route before the next handler so that it can get the route from the context
+			_, _, _ = findRoute(options.Router, r)
+			irw := options.newBufferingResponseWriter(w)
+			defer irw.Close()
+			if validates := options.ValidateResponseStatuses; validates != nil {
+				sw := &statusSelectingResponseWriter{BufferingResponseWriter: irw, rw: w, validates: validates}
+				next.ServeHTTP(sw, r)
+				if sw.bypassed {
+					options.skipped(r, SkipReasonStatusNotValidated)
+					return
+				}
+				if !sw.wroteHeader && !validates(http.StatusOK) {
+					options.skipped(r, SkipReasonStatusNotValidated)
+					irw.Emit()
+					return
+				}
+			} else {
+				next.ServeHTTP(irw, r)
+			}
+			if irw.Hijacked() {
+				options.skipped(r, SkipReasonHijacked)
+				return
+			}
+			if options.PostTransform != nil {
+				transformed, err := options.transformResponse(w, irw)
+				if err != nil {
+					span.RecordError(err)
+					respondErrorJSON(w, http.StatusInternalServerError, err)
+					return
+				}
+				irw = transformed
+			}
 			ri, err := buildRequestValidationInputFromRequest(options.Router, r, options.ValidationOptions)
 			if frErr := new(findRouteErr); errors.As(err, &frErr) {
 				actualErr := frErr.Unwrap()
 				span.RecordError(actualErr)
+				options.sendToSink(ctx, r, PhaseFindRoute, nil, actualErr)
 				options.reportFindRouteError(w, r, actualErr)
 				return
 			} else if err != nil {
@@ -81,36 +319,293 @@ func WithResponseValidation(options MiddlewareOptions) middleware {
 			}
 			input := &openapi3filter.ResponseValidationInput{
 				RequestValidationInput: ri,
-				Status:                 irw.statusCode,
+				Status:                 irw.StatusCode(),
 				Header:                 irw.Header(),
 			}
 			if input.Status == 0 {
 				input.Status = http.StatusOK
 			}
-			bodyBytes := irw.buf.Bytes()
-			input.SetBodyBytes(bodyBytes)
-			if err := openapi3filter.ValidateResponse(ctx, input); err != nil {
-				span.RecordError(err)
+			if status, ok := options.trailerStatus(irw.Header()); ok {
+				input.Status = status
+			}
+			if options.HandleConditionalRequests && notModified(r, input.Status, irw.Header()) {
+				options.skipped(r, SkipReasonNotModified)
+				respondNotModified(w)
+				return
+			}
+			options.recordValidationOptions(span, ri.Options)
+			span.SetAttributes(attribute.Int64("openapi.response.body_size", irw.BodySize()))
+			if reason, ok := responseSkipReason(input, irw.BodySize()); ok {
+				options.skipped(r, reason)
+			}
+			err = validateBufferedResponse(ctx, input, irw)
+			if err == nil && options.ForbidUndeclaredResponseHeaders {
+				err = checkUndeclaredResponseHeaders(input, options.AllowedUndeclaredResponseHeaders)
+			}
+			bodySizes.Record(ctx, irw.BodySize(), outcomeOf(err))
+			if err != nil {
+				recordError(span, err)
+				mode := options.responseMode(ctx)
+				result := ValidationResult{Phase: PhaseResponse, Method: r.Method, Path: r.URL.Path, Route: ri.Route, Err: err, Observed: mode == Observe}
+				if observed := obs.takeRequest(); observed != nil {
+					result.RequestErr = observed.Err
+				}
+				options.send(ctx, result)
+				if mode == Observe {
+					emitResponse(w, r, irw)
+					return
+				}
 				options.reportRespError(w, r, err)
 				return
 			}
-			irw.emit()
+			emitResponse(w, r, irw)
 		})
 	}
 }
 
+// aliasContentType replaces Content-Type of the request with its alias and returns the function that restores the original one.
+func (o MiddlewareOptions) aliasContentType(r *http.Request) func() {
+	noop := func() {}
+	if len(o.ContentTypeAliases) == 0 {
+		return noop
+	}
+	original := r.Header.Get("content-type")
+	mediaType, _, err := mime.ParseMediaType(original)
+	if err != nil {
+		return noop
+	}
+	alias, ok := o.ContentTypeAliases[mediaType]
+	if !ok {
+		return noop
+	}
+	r.Header.Set("content-type", alias)
+	return func() { r.Header.Set("content-type", original) }
+}
+
+// trailerStatus returns the status code conveyed by the GrpcStatusTrailer trailer.
+func (o MiddlewareOptions) trailerStatus(header http.Header) (int, bool) {
+	if o.GrpcStatusTrailer == "" {
+		return 0, false
+	}
+	value := header.Get(http.TrailerPrefix + o.GrpcStatusTrailer)
+	if value == "" {
+		value = header.Get(o.GrpcStatusTrailer)
+	}
+	status, err := strconv.Atoi(value)
+	if err != nil || status < 100 || status > 999 {
+		return 0, false
+	}
+	return status, true
+}
+
+// transformResponse returns irw whose body is replaced with the one rewritten by PostTransform.
+func (o MiddlewareOptions) transformResponse(w http.ResponseWriter, irw BufferingResponseWriter) (BufferingResponseWriter, error) {
+	body, err := irw.Body()
+	if err != nil {
+		return nil, err
+	}
+	original, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return &transformedResponseWriter{BufferingResponseWriter: irw, rw: w, body: o.PostTransform(original)}, nil
+}
+
+// transformedResponseWriter is the BufferingResponseWriter that holds the body rewritten by PostTransform instead of the one written by the handler.
+type transformedResponseWriter struct {
+	BufferingResponseWriter
+	rw   http.ResponseWriter
+	body []byte
+}
+
+func (w *transformedResponseWriter) Body() (io.Reader, error) {
+	return bytes.NewReader(w.body), nil
+}
+
+func (w *transformedResponseWriter) BodySize() int64 {
+	return int64(len(w.body))
+}
+
+// Emit sends the status written by the handler and the rewritten body.
+// Content-Length is set to the length of the rewritten body because the whole body is held.
+func (w *transformedResponseWriter) Emit() {
+	w.Header().Set("content-length", strconv.Itoa(len(w.body)))
+	if status := w.StatusCode(); status != 0 {
+		w.rw.WriteHeader(status)
+	}
+	_, _ = w.rw.Write(w.body)
+}
+
+// emitResponse sends the response held by irw.
+// The body of the response to HEAD requests is discarded because it must not be sent.
+func emitResponse(w http.ResponseWriter, r *http.Request, irw BufferingResponseWriter) {
+	if r.Method != http.MethodHead {
+		irw.Emit()
+		return
+	}
+	status := irw.StatusCode()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+}
+
+// validateBufferedResponse validates the response held by irw.
+// Only the status and the headers of the response to HEAD requests are validated.
+func validateBufferedResponse(ctx context.Context, input *openapi3filter.ResponseValidationInput, irw BufferingResponseWriter) error {
+	if input.RequestValidationInput.Request.Method == http.MethodHead {
+		return validateResponseRecovering(ctx, withoutResponseBody(input))
+	}
+	if irw.BodySize() == 0 && declaresResponseContent(input) {
+		return &openapi3filter.ResponseError{Input: input, Reason: "response body is empty though the response declares its content"}
+	}
+	body, err := irw.Body()
+	if err != nil {
+		return &openapi3filter.ResponseError{Input: input, Reason: "failed to read buffered response body", Err: err}
+	}
+	if irw.Header().Get("content-encoding") == "gzip" {
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			return &openapi3filter.ResponseError{Input: input, Reason: "failed to decompress response body", Err: err}
+		}
+		defer gr.Close()
+		body = gr
+	}
+	input.Body = io.NopCloser(body)
+	return validateResponseRecovering(ctx, input)
+}
+
+// withoutResponseBody returns the copy of input that excludes the response body from the validation.
+//
+// openapi3filter.ValidateResponse skips the responses to HEAD requests entirely,
+// so the method of the copied request is replaced with GET to validate the status and the headers against the route of the HEAD operation.
+func withoutResponseBody(input *openapi3filter.ResponseValidationInput) *openapi3filter.ResponseValidationInput {
+	var opts openapi3filter.Options
+	if input.Options != nil {
+		opts = *input.Options
+	}
+	opts.ExcludeResponseBody = true
+	req := new(http.Request)
+	*req = *input.RequestValidationInput.Request
+	req.Method = http.MethodGet
+	ri := *input.RequestValidationInput
+	ri.Request = req
+	ri.Options = &opts
+	copied := *input
+	copied.RequestValidationInput = &ri
+	copied.Options = &opts
+	copied.Body = io.NopCloser(strings.NewReader(""))
+	return &copied
+}
+
+// validateResponseRecovering calls openapi3filter.ValidateResponse and converts the panic into ResponseError.
+//
+// ValidateResponse may panic for the malformed spec such as the response without its schema resolved.
+func validateResponseRecovering(ctx context.Context, input *openapi3filter.ResponseValidationInput) (err error) {
+	defer func() {
+		if rv := recover(); rv != nil {
+			err = &openapi3filter.ResponseError{Input: input, Reason: "panic while validating response", Err: &recoveredPanic{value: rv, stack: debug.Stack()}}
+		}
+	}()
+	return openapi3filter.ValidateResponse(ctx, input)
+}
+
+type recoveredPanic struct {
+	value interface{}
+	stack []byte
+}
+
+func (p *recoveredPanic) Error() string {
+	return fmt.Sprintf("panic: %v", p.value)
+}
+
+// recordValidationOptions records the openapi3filter.Options field by field as the span event.
+//
+// The nil options are recorded as the zero options that openapi3filter uses instead.
+func (o MiddlewareOptions) recordValidationOptions(span trace.Span, opts *openapi3filter.Options) {
+	if !o.Debug {
+		return
+	}
+	if opts == nil {
+		opts = &openapi3filter.Options{}
+	}
+	span.AddEvent("openapi3filter.Options", trace.WithAttributes(
+		attribute.Bool("exclude_request_body", opts.ExcludeRequestBody),
+		attribute.Bool("exclude_response_body", opts.ExcludeResponseBody),
+		attribute.Bool("exclude_read_only_validations", opts.ExcludeReadOnlyValidations),
+		attribute.Bool("exclude_write_only_validations", opts.ExcludeWriteOnlyValidations),
+		attribute.Bool("include_response_status", opts.IncludeResponseStatus),
+		attribute.Bool("multi_error", opts.MultiError),
+		attribute.Bool("authentication_func", opts.AuthenticationFunc != nil),
+		attribute.Bool("skip_setting_defaults", opts.SkipSettingDefaults),
+		attribute.Bool("concurrent_validation", o.ConcurrentValidation),
+	))
+}
+
+// recordError records err in the span with the stack trace of the panic if err is caused by recoveredPanic.
+func recordError(span trace.Span, err error) {
+	if rp := new(recoveredPanic); errors.As(err, &rp) {
+		span.RecordError(err, trace.WithAttributes(attribute.String("exception.stacktrace", string(rp.stack))))
+		return
+	}
+	span.RecordError(err)
+}
+
+// declaresResponseContent reports whether the spec declares the content of the response that openapi3filter.ValidateResponse validates.
+func declaresResponseContent(input *openapi3filter.ResponseValidationInput) bool {
+	ri := input.RequestValidationInput
+	if ri.Request.Method == http.MethodHead {
+		return false
+	}
+	if opts := ri.Options; opts != nil && opts.ExcludeResponseBody {
+		return false
+	}
+	switch input.Status {
+	case http.StatusNotModified, http.StatusPermanentRedirect, http.StatusTemporaryRedirect, http.StatusMovedPermanently:
+		return false
+	}
+	responses := ri.Route.Operation.Responses
+	if responses.Len() == 0 {
+		return false
+	}
+	ref := responses.Status(input.Status)
+	if ref == nil {
+		ref = responses.Default()
+	}
+	return ref != nil && ref.Value != nil && len(ref.Value.Content) > 0
+}
+
 // WithRequestValidation returns a middleware that validates against request.
-// It immediately returns an error response and does not call next handler if validation failed.
-func WithRequestValidation(options MiddlewareOptions) middleware {
+// It immediately returns an error response and does not call next handler if validation failed,
+// unless MiddlewareOptions.RequestMode is Observe.
+// The size of the request body is recorded as openapi.request.body_size attribute of the span,
+// and as openapi.request.body_size histogram with the outcome of the validation if it is known.
+func WithRequestValidation(options MiddlewareOptions) Middleware {
+	bodySizes := newBodySizeHistogram(options, "openapi.request.body_size", "The size of the validated request body.")
 	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		return options.validatingHandler(func(w http.ResponseWriter, r *http.Request) {
+			r, overridden := options.overrideMethod(r)
 			ctx := r.Context()
 			ctx, span := getTracer(ctx, options).Start(ctx, "RequestValidation")
 			defer span.End()
+			if overridden {
+				recordMethodOverride(span, r)
+			}
+			ctx = withRouteCache(ctx)
+			ctx = withObservation(ctx)
+			r = r.WithContext(ctx)
+			if options.TreatNullAsAbsent {
+				if err := stripJSONNulls(r); err != nil {
+					span.RecordError(err)
+					respondErrorJSON(w, http.StatusInternalServerError, err)
+					return
+				}
+			}
 			input, err := buildRequestValidationInputFromRequest(options.Router, r, options.ValidationOptions)
 			if frErr := new(findRouteErr); errors.As(err, &frErr) {
 				actualErr := frErr.Unwrap()
 				span.RecordError(actualErr)
+				options.sendToSink(ctx, r, PhaseFindRoute, nil, actualErr)
 				options.reportFindRouteError(w, r, actualErr)
 				return
 			} else if err != nil {
@@ -118,16 +613,124 @@ func WithRequestValidation(options MiddlewareOptions) middleware {
 				respondErrorJSON(w, http.StatusInternalServerError, err)
 				return
 			}
-			if err := openapi3filter.ValidateRequest(ctx, input); err != nil {
+			obs := observationFromContext(ctx)
+			counter := countRequestBody(r)
+			err = options.validateRequestInput(ctx, span, input)
+			if size, ok := counter.size(); ok {
+				span.SetAttributes(attribute.Int64("openapi.request.body_size", size))
+				bodySizes.Record(ctx, size, outcomeOf(err))
+			}
+			if err != nil {
 				span.RecordError(err)
-				options.reportReqError(w, r, err)
-				return
+				result := ValidationResult{Phase: PhaseRequest, Method: r.Method, Path: r.URL.Path, Route: input.Route, Err: err}
+				if options.requestMode(ctx) != Observe {
+					options.send(ctx, result)
+					options.reportReqError(w, r, err)
+					return
+				}
+				result.Observed = true
+				obs.observeRequest(result)
+			}
+			next.ServeHTTP(w, r)
+			// the response validation delivers the observed failure with its own result if it follows
+			if !obs.responsePending {
+				if result := obs.takeRequest(); result != nil {
+					options.send(ctx, *result)
+				}
 			}
-			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// validateRequestInput validates the request and returns the first failure.
+func (o MiddlewareOptions) validateRequestInput(ctx context.Context, span trace.Span, input *openapi3filter.RequestValidationInput) error {
+	r := input.Request
+	if o.ParameterMapper != nil {
+		restoreParameters := mapParameters(input, o.ParameterMapper(r))
+		defer restoreParameters()
+	}
+	if o.CoerceScalars {
+		restoreParams := coerceScalarParams(input)
+		defer restoreParams()
+	}
+	if header := o.DiscriminatorHeader; header != "" {
+		if err := selectRequestBodyByHeader(input, header); err != nil {
+			return err
+		}
+	}
+	restoreContentType := o.aliasContentType(r)
+	defer restoreContentType()
+	if o.StrictNumbers {
+		if err := checkStrictNumbers(input); err != nil {
+			return err
+		}
+	}
+	restoreBody, err := decodeContentEncodedBody(input)
+	if err != nil {
+		return err
+	}
+	defer restoreBody()
+	o.recordValidationOptions(span, input.Options)
+	validate := openapi3filter.ValidateRequest
+	if o.ConcurrentValidation {
+		validate = validateRequestConcurrently
+	}
+	return validate(ctx, input)
+}
+
+// validateRequestConcurrently validates the request body in another goroutine while validating the other parts of the request.
+func validateRequestConcurrently(ctx context.Context, input *openapi3filter.RequestValidationInput) error {
+	var opts openapi3filter.Options
+	if input.Options != nil {
+		opts = *input.Options
+	}
+	requestBody := input.Route.Operation.RequestBody
+	if opts.ExcludeRequestBody || requestBody == nil || requestBody.Value == nil {
+		return openapi3filter.ValidateRequest(ctx, input)
+	}
+
+	// the body is validated with the copy of the request because setting default values of parameters modifies the request
+	bodyInput := *input
+	bodyInput.Request = input.Request.Clone(ctx)
+	var bodyErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		bodyErr = openapi3filter.ValidateRequestBody(ctx, &bodyInput, requestBody.Value)
+	}()
+
+	paramsInput := *input
+	paramsOpts := opts
+	paramsOpts.ExcludeRequestBody = true
+	paramsInput.Options = &paramsOpts
+	paramsErr := openapi3filter.ValidateRequest(ctx, &paramsInput)
+	<-done
+	// ValidateRequestBody replaces the body to let the next handler read it
+	input.Request.Body = bodyInput.Request.Body
+	input.Request.GetBody = bodyInput.Request.GetBody
+
+	switch {
+	case paramsErr != nil && bodyErr != nil:
+		if !opts.MultiError {
+			return paramsErr
+		}
+		var me openapi3.MultiError
+		if !errors.As(paramsErr, &me) {
+			me = openapi3.MultiError{paramsErr}
+		}
+		return append(me, bodyErr)
+	case paramsErr != nil:
+		return paramsErr
+	case bodyErr != nil:
+		if opts.MultiError {
+			return openapi3.MultiError{bodyErr}
+		}
+		return bodyErr
+	default:
+		return nil
+	}
+}
+
 type findRouteErr struct {
 	err error
 }
@@ -141,10 +744,11 @@ func (e *findRouteErr) Error() string {
 }
 
 func buildRequestValidationInputFromRequest(router routers.Router, r *http.Request, options *openapi3filter.Options) (*openapi3filter.RequestValidationInput, error) {
-	route, pathParams, err := router.FindRoute(r)
+	route, pathParams, err := findRoute(router, r)
 	if err != nil {
 		return nil, &findRouteErr{err: err}
 	}
+	unescapePathParams(r, pathParams)
 	input := &openapi3filter.RequestValidationInput{
 		Request:    r,
 		PathParams: pathParams,
@@ -154,47 +758,199 @@ func buildRequestValidationInputFromRequest(router routers.Router, r *http.Reque
 	return input, nil
 }
 
+// unescapePathParams unescapes the values of path parameters in place.
+//
+// Some routers such as gorillamux match against the escaped path to keep encoded slashes (%2F) in a parameter,
+// but openapi3filter validates the values as they are.
+// unescapePathParams decodes the values of the path parameters that the router has extracted from the escaped path such as gorillamux does.
+// The values extracted from the decoded path such as the ones of legacy router are left as they are not to decode them twice.
+func unescapePathParams(r *http.Request, pathParams map[string]string) {
+	escapedPath := r.URL.EscapedPath()
+	for name, value := range pathParams {
+		if !strings.Contains(value, "%") {
+			continue
+		}
+		if !strings.Contains(escapedPath, value) || strings.Contains(r.URL.Path, value) {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(value); err == nil {
+			pathParams[name] = unescaped
+		}
+	}
+}
+
+// stripJSONNulls replaces the JSON body of the request with the one that null values in objects are removed from.
+// It leaves the body that is not JSON or malformed as it is.
+func stripJSONNulls(r *http.Request) error {
+	if r.Body == nil || r.Body == http.NoBody || !isJSONMediaType(r.Header.Get("content-type")) {
+		return nil
+	}
+	data, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return err
+	}
+	setRequestBody(r, data)
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil
+	}
+	stripped, err := json.Marshal(removeNulls(v))
+	if err != nil {
+		return err
+	}
+	setRequestBody(r, stripped)
+	return nil
+}
+
+func removeNulls(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			if child == nil {
+				delete(v, k)
+				continue
+			}
+			v[k] = removeNulls(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = removeNulls(child)
+		}
+	}
+	return v
+}
+
+func setRequestBody(r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	r.ContentLength = int64(len(body))
+}
+
+func isJSONMediaType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// ErrorCode is a stable identifier of the kind of validation failure.
+type ErrorCode string
+
+const (
+	ErrorCodeMissingRequired      ErrorCode = "MISSING_REQUIRED"
+	ErrorCodeTypeMismatch         ErrorCode = "TYPE_MISMATCH"
+	ErrorCodeFormat               ErrorCode = "FORMAT"
+	ErrorCodeEnum                 ErrorCode = "ENUM"
+	ErrorCodePattern              ErrorCode = "PATTERN"
+	ErrorCodeRange                ErrorCode = "RANGE"
+	ErrorCodeLength               ErrorCode = "LENGTH"
+	ErrorCodeUniqueItems          ErrorCode = "UNIQUE_ITEMS"
+	ErrorCodeAdditionalProperties ErrorCode = "ADDITIONAL_PROPERTIES"
+	ErrorCodeComposition          ErrorCode = "COMPOSITION"
+	ErrorCodeInvalid              ErrorCode = "INVALID"
+	// ErrorCodeMissingParameter means a required parameter is missing.
+	ErrorCodeMissingParameter ErrorCode = "MISSING_PARAMETER"
+	// ErrorCodeInsufficientScope means the granted scopes lack some of the required scopes.
+	ErrorCodeInsufficientScope ErrorCode = "INSUFFICIENT_SCOPE"
+)
+
+// errorCodeOf returns the ErrorCode that corresponds to openapi3.SchemaError.SchemaField.
+func errorCodeOf(schemaField string) ErrorCode {
+	switch schemaField {
+	case "required":
+		return ErrorCodeMissingRequired
+	case "type", "nullable":
+		return ErrorCodeTypeMismatch
+	case "format":
+		return ErrorCodeFormat
+	case "enum":
+		return ErrorCodeEnum
+	case "pattern":
+		return ErrorCodePattern
+	case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "multipleOf":
+		return ErrorCodeRange
+	case "minLength", "maxLength", "minItems", "maxItems", "minProperties", "maxProperties":
+		return ErrorCodeLength
+	case "uniqueItems":
+		return ErrorCodeUniqueItems
+	case "properties":
+		return ErrorCodeAdditionalProperties
+	case "allOf", "anyOf", "oneOf", "not", "discriminator":
+		return ErrorCodeComposition
+	default:
+		return ErrorCodeInvalid
+	}
+}
+
 type report struct {
 	Reason      string           `json:"reason"`
+	Code        ErrorCode        `json:"code"`
 	Field       string           `json:"field"`
 	Value       interface{}      `json:"value"`
 	Schema      *openapi3.Schema `json:"schema"`
 	OriginError string           `json:"origin,omitempty"`
+	Parameter   string           `json:"parameter,omitempty"`
+	In          string           `json:"in,omitempty"`
+	// AllowedValues is the list of values acceptable for the enum constraint.
+	AllowedValues []interface{} `json:"allowedValues,omitempty"`
+	// Branches has the reasons why the branches of the composition (oneOf, anyOf and allOf) fail.
+	Branches []*branchReport `json:"branches,omitempty"`
+	// MissingScopes is the list of scopes that the security requirement requires but are not granted.
+	MissingScopes []string `json:"missingScopes,omitempty"`
 }
 
-func defaultReportFindRouteError(w http.ResponseWriter, err error) {
-	respondErrorJSON(w, http.StatusInternalServerError, err)
+type branchReport struct {
+	Index   int       `json:"index"`
+	Ref     string    `json:"ref,omitempty"`
+	Reports []*report `json:"reports"`
 }
 
-func defaultReportRequestError(w http.ResponseWriter, err error) {
+func defaultReportFindRouteError(w http.ResponseWriter, err error, extra map[string]interface{}) {
+	_ = respondJSON(w, http.StatusInternalServerError, withExtra(errorPayload(err), extra))
+}
+
+func defaultReportRequestError(w http.ResponseWriter, err error, maxReports int, extra map[string]interface{}) {
+	if reportInsufficientScope(w, err, extra) {
+		return
+	}
 	requestErr := new(openapi3filter.RequestError)
 	if !errors.As(err, &requestErr) {
 		return
 	}
-	schemaErr := new(openapi3.SchemaError)
-	if errors.As(requestErr.Err, &schemaErr) {
-		_ = respondJSON(w, http.StatusBadRequest, rootError{
-			Error: errorAggregate{
-				Request: toReport(schemaErr),
-			}})
+	var rpt *report
+	if schemaErr := new(openapi3.SchemaError); errors.As(requestErr.Err, &schemaErr) {
+		rpt = toReport(schemaErr)
+		rpt.setParameter(requestErr.Parameter)
+	} else if isMissingParameter(validationFailure{param: requestErr.Parameter, err: requestErr.Err}) {
+		rpt = toMissingParameterReport(requestErr.Parameter)
+	}
+	if rpt != nil {
+		agg := errorAggregate{Request: rpt}
+		agg.setReports(collectReports(err), maxReports)
+		_ = respondJSON(w, http.StatusBadRequest, withExtra(rootError{Error: agg}, extra))
 		return
 	}
-	respondErrorJSON(w, http.StatusBadRequest, requestErr)
+	_ = respondJSON(w, http.StatusBadRequest, withExtra(errorPayload(requestErr), extra))
 }
 
-func defaultReportResponseError(w http.ResponseWriter, err error) {
+func defaultReportResponseError(w http.ResponseWriter, err error, maxReports int, extra map[string]interface{}) {
 	responseErr := new(openapi3filter.ResponseError)
 	if !errors.As(err, &responseErr) {
 		return
 	}
 	if schemaErr := new(openapi3.SchemaError); errors.As(responseErr.Err, &schemaErr) {
-		_ = respondJSON(w, http.StatusInternalServerError, rootError{
-			Error: errorAggregate{
-				Response: toReport(schemaErr),
-			}})
+		agg := errorAggregate{Response: toReport(schemaErr)}
+		agg.setReports(collectReports(err), maxReports)
+		_ = respondJSON(w, http.StatusInternalServerError, withExtra(rootError{Error: agg}, extra))
 		return
 	}
-	respondErrorJSON(w, http.StatusInternalServerError, responseErr)
+	_ = respondJSON(w, http.StatusInternalServerError, withExtra(errorPayload(responseErr), extra))
 }
 
 type rootError struct {
@@ -204,21 +960,122 @@ type rootError struct {
 type errorAggregate struct {
 	Request  *report `json:"request,omitempty"`
 	Response *report `json:"response,omitempty"`
+	// Reports has every report if there are multiple errors.
+	Reports   []*report `json:"reports,omitempty"`
+	Total     int       `json:"total,omitempty"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// setReports sets the reports up to maxReports if there are multiple reports.
+func (agg *errorAggregate) setReports(reports []*report, maxReports int) {
+	if len(reports) <= 1 {
+		return
+	}
+	agg.Total = len(reports)
+	if maxReports > 0 && len(reports) > maxReports {
+		reports = reports[:maxReports]
+		agg.Truncated = true
+	}
+	agg.Reports = reports
+}
+
+// collectReports returns the reports of every SchemaError and missing parameter contained in err.
+func collectReports(err error) []*report {
+	var reports []*report
+	walkValidationErrors(err, func(failure validationFailure) {
+		if isMissingParameter(failure) {
+			reports = append(reports, toMissingParameterReport(failure.param))
+			return
+		}
+		if schemaErr, ok := failure.schemaError(); ok {
+			rpt := toReport(schemaErr)
+			rpt.setParameter(failure.param)
+			reports = append(reports, rpt)
+		}
+	})
+	return reports
+}
+
+func (rpt *report) setParameter(param *openapi3.Parameter) {
+	if param == nil {
+		return
+	}
+	rpt.Parameter = param.Name
+	rpt.In = param.In
+}
+
+func isMissingParameter(failure validationFailure) bool {
+	return failure.param != nil && errors.Is(failure.err, openapi3filter.ErrInvalidRequired)
+}
+
+func toMissingParameterReport(param *openapi3.Parameter) *report {
+	rpt := &report{
+		Reason: fmt.Sprintf("parameter %q in %s is required but missing", param.Name, param.In),
+		Code:   ErrorCodeMissingParameter,
+		Field:  "required",
+	}
+	if param.Schema != nil {
+		rpt.Schema = param.Schema.Value
+	}
+	rpt.setParameter(param)
+	return rpt
 }
 
 func toReport(schemaErr *openapi3.SchemaError) *report {
 	if schemaErr == nil {
 		return nil
 	}
-	return &report{
+	rpt := &report{
 		Reason: schemaErr.Reason,
+		Code:   errorCodeOf(schemaErr.SchemaField),
 		Field:  schemaErr.SchemaField,
 		Value:  schemaErr.Value,
 		Schema: schemaErr.Schema,
 	}
+	if schemaErr.SchemaField == "enum" && schemaErr.Schema != nil {
+		rpt.AllowedValues = schemaErr.Schema.Enum
+	}
+	rpt.Branches = compositionBranches(schemaErr)
+	return rpt
+}
+
+// compositionBranches returns the reports of the branches that the value does not match if the composition fails.
+//
+// The branches are validated again because SchemaError does not always hold the errors of them.
+func compositionBranches(schemaErr *openapi3.SchemaError) []*branchReport {
+	if schemaErr.Schema == nil {
+		return nil
+	}
+	var branches openapi3.SchemaRefs
+	switch schemaErr.SchemaField {
+	case "oneOf":
+		branches = schemaErr.Schema.OneOf
+	case "anyOf":
+		branches = schemaErr.Schema.AnyOf
+	case "allOf":
+		branches = schemaErr.Schema.AllOf
+	default:
+		return nil
+	}
+	var reports []*branchReport
+	for i, branch := range branches {
+		if branch == nil || branch.Value == nil {
+			continue
+		}
+		err := branch.Value.VisitJSON(schemaErr.Value, openapi3.MultiErrors())
+		if err == nil {
+			continue
+		}
+		reports = append(reports, &branchReport{Index: i, Ref: branch.Ref, Reports: collectReports(err)})
+	}
+	return reports
 }
 
 func respondErrorJSON(w http.ResponseWriter, statusCode int, err error) {
+	_ = respondJSON(w, statusCode, errorPayload(err))
+}
+
+func errorPayload(err error) interface{} {
 	type errorStruct struct {
 		Message string
 		Kind    string
@@ -226,11 +1083,38 @@ func respondErrorJSON(w http.ResponseWriter, statusCode int, err error) {
 	type payload struct {
 		Error *errorStruct
 	}
-	_ = respondJSON(w, statusCode, payload{Error: &errorStruct{Message: err.Error(), Kind: fmt.Sprintf("%T", err)}})
+	return payload{Error: &errorStruct{Message: err.Error(), Kind: fmt.Sprintf("%T", err)}}
+}
+
+// withExtra returns the payload that the members of extra are merged into.
+// The members of the payload take precedence over extra.
+func withExtra(payload interface{}, extra map[string]interface{}) interface{} {
+	if len(extra) == 0 {
+		return payload
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return payload
+	}
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &members); err != nil {
+		return payload
+	}
+	merged := make(map[string]interface{}, len(members)+len(extra))
+	for k, v := range extra {
+		merged[k] = v
+	}
+	for k, v := range members {
+		merged[k] = v
+	}
+	return merged
 }
 
 func respondJSON(w http.ResponseWriter, statusCode int, payload interface{}) error {
 	w.Header().Set("content-type", "application/json")
+	// the handler may have declared the encoding and the length of the body that is discarded
+	w.Header().Del("content-encoding")
+	w.Header().Del("content-length")
 	w.WriteHeader(statusCode)
 	return json.NewEncoder(w).Encode(payload)
 }
@@ -3,25 +3,33 @@ package openapi3middleware
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
-	"net/http/httputil"
-	"net/url"
 	"os"
-	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/getkin/kin-openapi/routers"
 	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/getkin/kin-openapi/routers/legacy"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.opentelemetry.io/otel/propagation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	"go.opentelemetry.io/otel/sdk/trace/tracetest"
@@ -93,6 +101,42 @@ func TestWithValidation(t *testing.T) {
 				_, _ = fmt.Fprintf(w, "the custom response validation error handler is called: errTypeOK=%t, request=%t", errTypeOK, requestNonNil)
 			},
 		},
+		{
+			name: "GET /users/{id}: path parameter error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/users/abc", map[string]string{}, ""))
+			},
+		},
+		{
+			name: "GET /files/{path}: encoded slash",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/files/a%2Fb", map[string]string{}, ""))
+			},
+		},
+		{
+			name: "GET /files/{path}: path parameter error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/files/a%2F1", map[string]string{}, ""))
+			},
+		},
+		{
+			name: "DELETE /users/{id}: missing required header",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodDelete, origin+"/users/123", map[string]string{}, ""))
+			},
+		},
 		{
 			name: "GET /unknown: find route error (not found)",
 			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -127,6 +171,42 @@ func TestWithValidation(t *testing.T) {
 				_, _ = fmt.Fprintf(w, "the custom find route error handler is called: errTypeOK=%t, request=%t", errTypeOK, requestNonNil)
 			},
 		},
+		{
+			name: "GET /articles: ok",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/articles?tags=1,2,3", map[string]string{}, ""))
+			},
+		},
+		{
+			name: "GET /articles: invalid array item",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/articles?tags=1,abc,3", map[string]string{}, ""))
+			},
+		},
+		{
+			name: "GET /comments: ok",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/comments?tags=1&tags=2&tags=3", map[string]string{}, ""))
+			},
+		},
+		{
+			name: "GET /comments: invalid array item",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/comments?tags=1&tags=abc&tags=3", map[string]string{}, ""))
+			},
+		},
 		{
 			name: "POST /users: ok",
 			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -146,6 +226,63 @@ func TestWithValidation(t *testing.T) {
 				return mustRequest(newRequest(http.MethodPost, origin+"/users", map[string]string{"content-type": "application/json"}, `{"name":"aereal","age":"abc"}`))
 			},
 		},
+		{
+			name: "POST /users: enum error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodPost, origin+"/users", map[string]string{"content-type": "application/json"}, `{"name":"aereal","age":17,"plan":"unknown"}`))
+			},
+		},
+		{
+			name: "POST /payments: matches no oneOf branch",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodPost, origin+"/payments", map[string]string{"content-type": "application/json"}, `{"cardNumber":"1234"}`))
+			},
+		},
+		{
+			name: "POST /users/search: ok",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode([]user{{Name: "aereal", Age: 17, ID: "123"}})
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodPost, origin+"/users/search", map[string]string{"content-type": "application/json"}, `{"names":["aereal"],"age":{"min":10,"max":20},"limit":10}`))
+			},
+		},
+		{
+			name: "POST /users/search: request error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodPost, origin+"/users/search", map[string]string{"content-type": "application/json"}, `{"names":["aereal"],"age":{"min":-1},"limit":10}`))
+			},
+		},
+		{
+			name: "POST /users: created without body",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("location", "/users/123")
+				w.WriteHeader(http.StatusCreated)
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodPost, origin+"/users", map[string]string{"content-type": "application/json"}, `{"name":"aereal","age":17}`))
+			},
+		},
+		{
+			name: "POST /articles: created without required body",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("location", "/articles/123")
+				w.WriteHeader(http.StatusCreated)
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodPost, origin+"/articles", map[string]string{}, ""))
+			},
+		},
 		{
 			name: "POST /users: request error with custom error handler",
 			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -181,7 +318,7 @@ func TestWithValidation(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			if err := testResponse(expectedResp, gotResp); err != nil {
+			if err := compareResponse(expectedResp, gotResp); err != nil {
 				t.Error(err)
 			}
 		})
@@ -264,98 +401,1985 @@ func TestWithValidation_otel(t *testing.T) {
 	}
 }
 
-func resumeResponse(testName string, got *http.Response) (*http.Response, error) {
-	imported, err := importResponse(testName)
-	if err == nil {
-		return imported, nil
-	}
-	// skip ErrNotExist
-	if !errors.Is(err, os.ErrNotExist) {
-		return nil, err
+func TestWithResponseValidation_spill(t *testing.T) {
+	testCases := []struct {
+		name       string
+		body       interface{}
+		wantStatus int
+	}{
+		{
+			name:       "ok",
+			body:       user{Name: strings.Repeat("a", 1024), Age: 17, ID: "123"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "response error",
+			body:       map[string]interface{}{"name": strings.Repeat("a", 1024), "age": 17},
+			wantStatus: http.StatusInternalServerError,
+		},
 	}
-	if err := exportResponse(testName, got); err != nil {
-		return nil, err
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			t.Setenv("TMPDIR", tmpDir)
+			want, err := json.Marshal(tc.body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_, _ = w.Write(want)
+				entries, err := os.ReadDir(tmpDir)
+				if err != nil {
+					t.Error(err)
+				}
+				if len(entries) != 1 {
+					t.Errorf("expected the body spilled to a temporary file but got %d entries", len(entries))
+				}
+			})
+			mw := WithResponseValidation(MiddlewareOptions{Router: router, ResponseSpillThreshold: 64})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/users/123", map[string]string{}, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantStatus == http.StatusOK && string(got) != string(want) {
+				t.Errorf("body:\ngot=%s\nexpected=%s", got, want)
+			}
+			entries, err := os.ReadDir(tmpDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 0 {
+				t.Errorf("temporary files are left: %d entries", len(entries))
+			}
+		})
 	}
-	return got, nil
-}
-
-func responseDataPath(testName string) string {
-	return filepath.Join("./testdata", url.QueryEscape(testName))
 }
 
-func importResponse(testName string) (*http.Response, error) {
-	f, err := os.Open(responseDataPath(testName))
-	if err != nil {
-		return nil, err
+func TestWithRequestValidation_treatNullAsAbsent(t *testing.T) {
+	testCases := []struct {
+		name              string
+		treatNullAsAbsent bool
+		body              string
+		wantStatus        int
+		wantBody          string
+	}{
+		{
+			name:              "ok",
+			treatNullAsAbsent: true,
+			body:              `{"name":"aereal","age":17,"nickname":null}`,
+			wantStatus:        http.StatusOK,
+			wantBody:          `{"age":17,"name":"aereal"}`,
+		},
+		{
+			name:              "required property",
+			treatNullAsAbsent: true,
+			body:              `{"name":"aereal","age":null}`,
+			wantStatus:        http.StatusBadRequest,
+		},
+		{
+			name:              "disabled",
+			treatNullAsAbsent: false,
+			body:              `{"name":"aereal","age":17,"nickname":null}`,
+			wantStatus:        http.StatusBadRequest,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var gotBody string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+				w.WriteHeader(http.StatusOK)
+			})
+			mw := WithRequestValidation(MiddlewareOptions{Router: router, TreatNullAsAbsent: tc.treatNullAsAbsent})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if gotBody != tc.wantBody {
+				t.Errorf("body passed to the handler:\ngot=%s\nexpected=%s", gotBody, tc.wantBody)
+			}
+		})
 	}
-	return http.ReadResponse(bufio.NewReader(f), nil)
 }
 
-func exportResponse(testName string, resp *http.Response) error {
-	f, err := os.OpenFile(responseDataPath(testName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	dumped, err := httputil.DumpResponse(resp, true)
-	if err != nil {
-		return fmt.Errorf("DumpResponse: %w", err)
+func TestToReport_code(t *testing.T) {
+	testCases := []struct {
+		name     string
+		schema   *openapi3.Schema
+		value    interface{}
+		wantCode ErrorCode
+	}{
+		{
+			name:     "missing required",
+			schema:   &openapi3.Schema{Type: openapi3.TypeObject, Required: []string{"name"}},
+			value:    map[string]interface{}{},
+			wantCode: ErrorCodeMissingRequired,
+		},
+		{
+			name:     "type mismatch",
+			schema:   openapi3.NewIntegerSchema(),
+			value:    "abc",
+			wantCode: ErrorCodeTypeMismatch,
+		},
+		{
+			name:     "format",
+			schema:   openapi3.NewStringSchema().WithFormat("date"),
+			value:    "abc",
+			wantCode: ErrorCodeFormat,
+		},
+		{
+			name:     "enum",
+			schema:   openapi3.NewStringSchema().WithEnum("a", "b"),
+			value:    "c",
+			wantCode: ErrorCodeEnum,
+		},
+		{
+			name:     "pattern",
+			schema:   openapi3.NewStringSchema().WithPattern("^[0-9]+$"),
+			value:    "abc",
+			wantCode: ErrorCodePattern,
+		},
+		{
+			name:     "range",
+			schema:   openapi3.NewIntegerSchema().WithMin(18),
+			value:    float64(17),
+			wantCode: ErrorCodeRange,
+		},
+		{
+			name:     "length",
+			schema:   openapi3.NewStringSchema().WithMaxLength(2),
+			value:    "abc",
+			wantCode: ErrorCodeLength,
+		},
+		{
+			name:     "unique items",
+			schema:   openapi3.NewArraySchema().WithItems(openapi3.NewStringSchema()).WithUniqueItems(true),
+			value:    []interface{}{"a", "a"},
+			wantCode: ErrorCodeUniqueItems,
+		},
+		{
+			name:     "additional properties",
+			schema:   openapi3.NewObjectSchema().WithProperty("name", openapi3.NewStringSchema()).WithoutAdditionalProperties(),
+			value:    map[string]interface{}{"name": "aereal", "age": float64(17)},
+			wantCode: ErrorCodeAdditionalProperties,
+		},
+		{
+			name:     "composition",
+			schema:   openapi3.NewOneOfSchema(openapi3.NewStringSchema(), openapi3.NewBoolSchema()),
+			value:    float64(17),
+			wantCode: ErrorCodeComposition,
+		},
 	}
-	if _, err := f.Write(dumped); err != nil {
-		return err
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.schema.VisitJSON(tc.value)
+			schemaErr := new(openapi3.SchemaError)
+			if !errors.As(err, &schemaErr) {
+				t.Fatalf("expected SchemaError but got %T (%v)", err, err)
+			}
+			if got := toReport(schemaErr).Code; got != tc.wantCode {
+				t.Errorf("Code:\ngot=%s\nexpected=%s", got, tc.wantCode)
+			}
+		})
 	}
-	return nil
 }
 
-func mustRequest(r *http.Request, err error) *http.Request {
-	if err != nil {
-		panic(err)
+func TestWithResponseValidation_gzip(t *testing.T) {
+	testCases := []struct {
+		name       string
+		body       interface{}
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "ok",
+			body:       user{Name: "aereal", Age: 17, ID: "123"},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"name":"aereal","id":"123","age":17}` + "\n",
+		},
+		{
+			name:       "response error",
+			body:       map[string]interface{}{"name": "aereal", "age": 17},
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"error":{"response":{"reason":"property \"id\" is missing","code":"MISSING_REQUIRED","field":"required","value":{"age":17,"name":"aereal"},"schema":{"properties":{"age":{"type":"integer"},"id":{"type":"string"},"name":{"type":"string"}},"required":["id","name","age"],"type":"object"}}}}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				w.Header().Set("content-encoding", "gzip")
+				gw := gzip.NewWriter(w)
+				_ = json.NewEncoder(gw).Encode(tc.body)
+				_ = gw.Close()
+			})
+			mw := WithResponseValidation(MiddlewareOptions{Router: router})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/users/123", map[string]string{}, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.wantBody {
+				t.Errorf("body:\ngot=%s\nexpected=%s", got, tc.wantBody)
+			}
+		})
 	}
-	return r
 }
 
-func newRequest(method, path string, headers map[string]string, body string) (*http.Request, error) {
-	req, err := http.NewRequest(method, path, strings.NewReader((body)))
-	if err != nil {
-		return nil, err
+func TestWithResponseValidation_mode(t *testing.T) {
+	testCases := []struct {
+		name        string
+		defaultMode ValidationMode
+		ctxMode     *ValidationMode
+		wantStatus  int
+	}{
+		{
+			name:        "default enforce",
+			defaultMode: Enforce,
+			wantStatus:  http.StatusInternalServerError,
+		},
+		{
+			name:        "default observe",
+			defaultMode: Observe,
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "context overrides enforce with observe",
+			defaultMode: Enforce,
+			ctxMode:     modePtr(Observe),
+			wantStatus:  http.StatusOK,
+		},
+		{
+			name:        "context overrides observe with enforce",
+			defaultMode: Observe,
+			ctxMode:     modePtr(Enforce),
+			wantStatus:  http.StatusInternalServerError,
+		},
 	}
-	for k, v := range headers {
-		req.Header.Set(k, v)
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			withMode := func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if tc.ctxMode != nil {
+						r = r.WithContext(WithResponseMode(r.Context(), *tc.ctxMode))
+					}
+					next.ServeHTTP(w, r)
+				})
+			}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "aereal", "age": 17})
+			})
+			mw := WithResponseValidation(MiddlewareOptions{Router: router, ResponseMode: tc.defaultMode})
+			srv := httptest.NewServer(withMode(mw(handler)))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/users/123", map[string]string{}, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusOK {
+				got, _ := io.ReadAll(resp.Body)
+				if want := `{"age":17,"name":"aereal"}` + "\n"; string(got) != want {
+					t.Errorf("body:\ngot=%s\nexpected=%s", got, want)
+				}
+			}
+		})
 	}
-	return req, nil
 }
 
-func testResponse(expected, got *http.Response) error {
-	if got.StatusCode != expected.StatusCode {
-		return fmt.Errorf("StatusCode: got=%d expected=%d", got.StatusCode, expected.StatusCode)
+func modePtr(mode ValidationMode) *ValidationMode {
+	return &mode
+}
+
+func TestOnlyUnder(t *testing.T) {
+	testCases := []struct {
+		name          string
+		prefix        string
+		path          string
+		wantValidated bool
+	}{
+		{name: "under the prefix", prefix: "/users", path: "/users/abc", wantValidated: true},
+		{name: "exactly the prefix", prefix: "/users/", path: "/users/", wantValidated: true},
+		{name: "outside the prefix", prefix: "/users", path: "/admin/abc", wantValidated: false},
+		{name: "sharing the prefix string", prefix: "/users", path: "/usersx/abc", wantValidated: false},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			mw := OnlyUnder(tc.prefix, WithRequestValidation(MiddlewareOptions{Router: router}))
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+tc.path, map[string]string{}, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			// every path in the test cases is invalid in the spec, so the validated requests fail
+			if validated := resp.StatusCode != http.StatusOK; validated != tc.wantValidated {
+				t.Errorf("validated: got=%t expected=%t (status=%d)", validated, tc.wantValidated, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestOnlyUnder_onValidationSkipped(t *testing.T) {
+	testCases := []struct {
+		name            string
+		prefix          string
+		path            string
+		status          int
+		validates       func(status int) bool
+		disableResponse bool
+		wantReasons     []string
+	}{
+		{name: "outside the prefix", prefix: "/users", path: "/admin/abc", status: http.StatusOK, wantReasons: []string{SkipReasonPath}},
+		{name: "not validated status", prefix: "/users", path: "/users/123", status: http.StatusNotFound, validates: Only2xx, wantReasons: []string{SkipReasonStatusNotValidated}},
+		{name: "undeclared status", prefix: "/users", path: "/users/123", status: http.StatusInternalServerError, wantReasons: []string{SkipReasonUndeclaredStatus}},
+		{name: "undeclared content", prefix: "/articles", path: "/articles", status: http.StatusOK, wantReasons: []string{SkipReasonUndeclaredContent}},
+		{name: "response validation disabled", prefix: "/users", path: "/users/123", status: http.StatusOK, disableResponse: true, wantReasons: []string{SkipReasonResponseValidationDisabled}},
+		{name: "validated", prefix: "/users", path: "/users/123", status: http.StatusOK, wantReasons: nil},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var reasons []string
+			options := MiddlewareOptions{
+				Router:                   router,
+				ValidateResponseStatuses: tc.validates,
+				OnValidationSkipped: func(r *http.Request, reason string) {
+					if r.URL.Path != tc.path {
+						t.Errorf("path: got=%q expected=%q", r.URL.Path, tc.path)
+					}
+					reasons = append(reasons, reason)
+				},
+			}
+			if tc.disableResponse {
+				disabled := false
+				options.EnableResponseValidation = &disabled
+			}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				w.WriteHeader(tc.status)
+				_, _ = io.WriteString(w, `{"id":"123","name":"aereal","age":17}`)
+			})
+			srv := httptest.NewServer(OnlyUnder(tc.prefix, WithValidation(options))(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+tc.path, map[string]string{}, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.status)
+			}
+			if !reflect.DeepEqual(reasons, tc.wantReasons) {
+				t.Errorf("reasons: got=%v expected=%v", reasons, tc.wantReasons)
+			}
+		})
+	}
+}
+
+func TestWithValidation_methodOverrideHeader(t *testing.T) {
+	testCases := []struct {
+		name       string
+		header     string
+		override   string
+		body       string
+		wantStatus int
+		wantMethod string
+		wantSpans  int
+	}{
+		{name: "overridden/ok", header: "X-HTTP-Method-Override", override: "PATCH", body: `{"name":"aereal"}`, wantStatus: http.StatusNoContent, wantMethod: http.MethodPatch, wantSpans: 1},
+		{name: "overridden/invalid body", header: "X-HTTP-Method-Override", override: "patch", body: `{"nickname":"aereal"}`, wantStatus: http.StatusBadRequest, wantSpans: 1},
+		{name: "not overridable method", header: "X-HTTP-Method-Override", override: "GET", body: `{"name":"aereal"}`, wantStatus: http.StatusInternalServerError},
+		{name: "no override header", header: "X-HTTP-Method-Override", override: "", body: `{"name":"aereal"}`, wantStatus: http.StatusInternalServerError},
+		{name: "option disabled", header: "", override: "PATCH", body: `{"name":"aereal"}`, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var gotMethod string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotMethod = r.Method
+				w.WriteHeader(http.StatusNoContent)
+			})
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			srv := httptest.NewServer(WithValidation(MiddlewareOptions{Router: router, TracerProvider: tp, MethodOverrideHeader: tc.header})(handler))
+			defer srv.Close()
+			headers := map[string]string{"content-type": "application/json"}
+			if tc.override != "" {
+				headers["X-HTTP-Method-Override"] = tc.override
+			}
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users/123", headers, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				body, _ := io.ReadAll(resp.Body)
+				t.Errorf("StatusCode: got=%d expected=%d (%s)", resp.StatusCode, tc.wantStatus, body)
+			}
+			if gotMethod != tc.wantMethod {
+				t.Errorf("method: got=%q expected=%q", gotMethod, tc.wantMethod)
+			}
+			// the span of the outermost layer that overrides the method agrees with the handler
+			var overriddenSpans int
+			for _, span := range exporter.GetSpans() {
+				for _, attr := range span.Attributes {
+					if attr.Key == "http.request.method" && attr.Value.AsString() == http.MethodPatch {
+						overriddenSpans++
+					}
+				}
+			}
+			if overriddenSpans != tc.wantSpans {
+				t.Errorf("spans with the overridden method: got=%d expected=%d", overriddenSpans, tc.wantSpans)
+			}
+		})
+	}
+}
+
+func TestWithResponseValidation_responseController(t *testing.T) {
+	testCases := []struct {
+		name       string
+		body       interface{}
+		wantStatus int
+	}{
+		{
+			name:       "ok",
+			body:       user{Name: "aereal", Age: 17, ID: "123"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "response error",
+			body:       map[string]interface{}{"name": "aereal", "age": 17},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				rc := http.NewResponseController(w)
+				if err := rc.SetWriteDeadline(time.Now().Add(time.Minute)); err != nil {
+					t.Errorf("SetWriteDeadline: %v", err)
+				}
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(tc.body)
+				if err := rc.Flush(); err != nil {
+					t.Errorf("Flush: %v", err)
+				}
+			})
+			mw := WithResponseValidation(MiddlewareOptions{Router: router})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/users/123", map[string]string{}, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_maxReportedErrors(t *testing.T) {
+	testCases := []struct {
+		name              string
+		maxReportedErrors int
+		wantReports       int
+		wantTotal         int
+		wantTruncated     bool
+	}{
+		{name: "unlimited", maxReportedErrors: 0, wantReports: 4, wantTotal: 4, wantTruncated: false},
+		{name: "truncated", maxReportedErrors: 2, wantReports: 2, wantTotal: 4, wantTruncated: true},
+		{name: "not exceeded", maxReportedErrors: 4, wantReports: 4, wantTotal: 4, wantTruncated: false},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mw := WithRequestValidation(MiddlewareOptions{
+				Router:            router,
+				ValidationOptions: &openapi3filter.Options{MultiError: true},
+				MaxReportedErrors: tc.maxReportedErrors,
+			})
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			})))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, `{"name":1,"age":"abc","nickname":2,"plan":"unknown"}`)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, http.StatusBadRequest)
+			}
+			var got rootError
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Error.Reports) != tc.wantReports {
+				t.Errorf("reports: got=%d expected=%d", len(got.Error.Reports), tc.wantReports)
+			}
+			if got.Error.Total != tc.wantTotal {
+				t.Errorf("total: got=%d expected=%d", got.Error.Total, tc.wantTotal)
+			}
+			if got.Error.Truncated != tc.wantTruncated {
+				t.Errorf("truncated: got=%t expected=%t", got.Error.Truncated, tc.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestWithValidation_errorExtraFunc(t *testing.T) {
+	testCases := []struct {
+		name       string
+		handler    http.Handler
+		request    func(origin string) *http.Request
+		wantStatus int
+		wantKey    string
+	}{
+		{
+			name: "request error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodPost, origin+"/users", map[string]string{"content-type": "application/json"}, `{"name":"aereal","age":"abc"}`))
+			},
+			wantStatus: http.StatusBadRequest,
+			wantKey:    "error",
+		},
+		{
+			name: "response error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "aereal", "age": 17})
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/users/123", map[string]string{}, ""))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantKey:    "error",
+		},
+		{
+			name: "find route error",
+			handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			}),
+			request: func(origin string) *http.Request {
+				return mustRequest(newRequest(http.MethodGet, origin+"/unknown", map[string]string{}, ""))
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantKey:    "Error",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mw := WithValidation(MiddlewareOptions{
+				Router: router,
+				ErrorExtraFunc: func(r *http.Request) map[string]interface{} {
+					return map[string]interface{}{"service": "user-account", "path": r.URL.Path, "error": "must be ignored", "Error": "must be ignored"}
+				},
+			})
+			srv := httptest.NewServer(mw(tc.handler))
+			defer srv.Close()
+			req := tc.request(srv.URL)
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			var got map[string]interface{}
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got["service"] != "user-account" {
+				t.Errorf("service: got=%v", got["service"])
+			}
+			if got["path"] != req.URL.Path {
+				t.Errorf("path: got=%v expected=%s", got["path"], req.URL.Path)
+			}
+			if _, ok := got[tc.wantKey].(map[string]interface{}); !ok {
+				t.Errorf("%s: got=%#v", tc.wantKey, got[tc.wantKey])
+			}
+		})
+	}
+}
+
+func TestWithResponseValidation_hijack(t *testing.T) {
+	testCases := []struct {
+		name    string
+		factory func(w http.ResponseWriter) BufferingResponseWriter
+	}{
+		{name: "default writer", factory: nil},
+		{name: "wrapped writer", factory: func(w http.ResponseWriter) BufferingResponseWriter {
+			return &statusRecordingWriter{BufferingResponseWriter: NewBufferingResponseWriter(w), recorded: new([]int)}
+		}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("upgrade", "example")
+				w.Header().Set("connection", "upgrade")
+				w.WriteHeader(http.StatusSwitchingProtocols)
+				conn, brw, err := http.NewResponseController(w).Hijack()
+				if err != nil {
+					t.Errorf("Hijack: %v", err)
+					return
+				}
+				defer conn.Close()
+				_, _ = brw.WriteString("hijacked")
+				_ = brw.Flush()
+			})
+			mw := WithResponseValidation(MiddlewareOptions{Router: router, ResponseWriterFactory: tc.factory})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+
+			conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := io.WriteString(conn, "GET /users/123 HTTP/1.1\r\nHost: example.com\r\n\r\n"); err != nil {
+				t.Fatal(err)
+			}
+			br := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(br, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, http.StatusSwitchingProtocols)
+			}
+			rest, err := io.ReadAll(br)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(rest) != "hijacked" {
+				t.Errorf("bytes after hijacked: got=%q", rest)
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_concurrentValidation(t *testing.T) {
+	testCases := []struct {
+		name              string
+		validationOptions *openapi3filter.Options
+		query             string
+		body              string
+	}{
+		{name: "ok", query: "?dryRun=true", body: `{"name":"aereal","age":17}`},
+		{name: "parameter error", query: "?dryRun=abc", body: `{"name":"aereal","age":17}`},
+		{name: "body error", query: "?dryRun=true", body: `{"name":"aereal","age":"abc"}`},
+		{name: "both errors", query: "?dryRun=abc", body: `{"name":"aereal","age":"abc"}`},
+		{name: "body error/multi error", validationOptions: &openapi3filter.Options{MultiError: true}, query: "?dryRun=true", body: `{"name":"aereal","age":"abc"}`},
+		{name: "both errors/multi error", validationOptions: &openapi3filter.Options{MultiError: true}, query: "?dryRun=abc", body: `{"name":"aereal","age":"abc"}`},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			do := func(concurrent bool) (int, string, string) {
+				var passedBody string
+				handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					b, _ := io.ReadAll(r.Body)
+					passedBody = string(b)
+					w.WriteHeader(http.StatusOK)
+				})
+				mw := WithRequestValidation(MiddlewareOptions{
+					Router:               router,
+					ValidationOptions:    tc.validationOptions,
+					ConcurrentValidation: concurrent,
+				})
+				srv := httptest.NewServer(mw(handler))
+				defer srv.Close()
+				resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users"+tc.query, map[string]string{"content-type": "application/json"}, tc.body)))
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+				b, _ := io.ReadAll(resp.Body)
+				return resp.StatusCode, string(b), passedBody
+			}
+			wantStatus, wantBody, wantPassedBody := do(false)
+			gotStatus, gotBody, gotPassedBody := do(true)
+			if gotStatus != wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", gotStatus, wantStatus)
+			}
+			if gotBody != wantBody {
+				t.Errorf("body:\ngot=%s\nexpected=%s", gotBody, wantBody)
+			}
+			if gotPassedBody != wantPassedBody {
+				t.Errorf("body passed to the handler:\ngot=%s\nexpected=%s", gotPassedBody, wantPassedBody)
+			}
+		})
+	}
+}
+
+func BenchmarkWithRequestValidation(b *testing.B) {
+	body := `{"name":"aereal","age":17}`
+	for _, concurrent := range []bool{false, true} {
+		concurrent := concurrent
+		b.Run(fmt.Sprintf("concurrent=%t", concurrent), func(b *testing.B) {
+			mw := WithRequestValidation(MiddlewareOptions{Router: router, ConcurrentValidation: concurrent})
+			handler := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/users?dryRun=true", strings.NewReader(body))
+				req.Header.Set("content-type", "application/json")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				if w.Code != http.StatusOK {
+					b.Fatalf("unexpected status code: %d", w.Code)
+				}
+			}
+		})
+	}
+}
+
+type statusRecordingWriter struct {
+	BufferingResponseWriter
+	recorded *[]int
+}
+
+func (w *statusRecordingWriter) WriteHeader(statusCode int) {
+	*w.recorded = append(*w.recorded, statusCode)
+	w.BufferingResponseWriter.WriteHeader(statusCode)
+}
+
+func TestWithResponseValidation_responseWriterFactory(t *testing.T) {
+	testCases := []struct {
+		name       string
+		status     int
+		body       interface{}
+		wantStatus int
+	}{
+		{
+			name:       "ok",
+			status:     http.StatusOK,
+			body:       user{Name: "aereal", Age: 17, ID: "123"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "response error",
+			status:     http.StatusOK,
+			body:       map[string]interface{}{"name": "aereal", "age": 17},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var recorded []int
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				w.WriteHeader(tc.status)
+				_ = json.NewEncoder(w).Encode(tc.body)
+				if err := http.NewResponseController(w).Flush(); err != nil {
+					t.Errorf("Flush: %v", err)
+				}
+			})
+			mw := WithResponseValidation(MiddlewareOptions{
+				Router: router,
+				ResponseWriterFactory: func(w http.ResponseWriter) BufferingResponseWriter {
+					return &statusRecordingWriter{BufferingResponseWriter: NewBufferingResponseWriter(w), recorded: &recorded}
+				},
+			})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/users/123", map[string]string{}, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if len(recorded) != 1 || recorded[0] != tc.status {
+				t.Errorf("recorded status: got=%v expected=[%d]", recorded, tc.status)
+			}
+		})
+	}
+}
+
+type stubRouter struct {
+	route *routers.Route
+}
+
+func (r *stubRouter) FindRoute(_ *http.Request) (*routers.Route, map[string]string, error) {
+	return r.route, map[string]string{}, nil
+}
+
+func TestWithResponseValidation_recoverPanic(t *testing.T) {
+	// the schema that is not resolved makes ValidateResponse panic
+	responses := openapi3.NewResponses(openapi3.WithStatus(http.StatusOK, &openapi3.ResponseRef{
+		Value: openapi3.NewResponse().WithJSONSchemaRef(&openapi3.SchemaRef{Ref: "#/components/schemas/Unresolved"}),
+	}))
+	r := &stubRouter{route: &routers.Route{Method: http.MethodGet, Path: "/", Operation: &openapi3.Operation{Responses: responses}}}
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	var reported error
+	mw := WithResponseValidation(MiddlewareOptions{
+		Router:         r,
+		TracerProvider: tp,
+		ReportResponseValidationError: func(w http.ResponseWriter, r *http.Request, err error) {
+			reported = err
+			w.WriteHeader(http.StatusInternalServerError)
+		},
+	})
+	srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(w).Encode(user{Name: "aereal", Age: 17, ID: "123"})
+	})))
+	defer srv.Close()
+	resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/", map[string]string{}, "")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	if responseErr := new(openapi3filter.ResponseError); !errors.As(reported, &responseErr) {
+		t.Errorf("reported error: %#v", reported)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || len(spans[0].Events) != 1 {
+		t.Fatalf("expected an exception event recorded: %#v", spans)
+	}
+	var hasStack bool
+	for _, attr := range spans[0].Events[0].Attributes {
+		if attr.Key == "exception.stacktrace" && attr.Value.AsString() != "" {
+			hasStack = true
+		}
+	}
+	if !hasStack {
+		t.Error("expected the stack trace of the panic recorded")
+	}
+}
+
+func TestWithRequestValidation_headerCaseInsensitive(t *testing.T) {
+	testCases := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{name: "ok/canonical", header: "X-Custom-Id", value: "123", wantStatus: http.StatusOK},
+		{name: "ok/lower case", header: "x-custom-id", value: "123", wantStatus: http.StatusOK},
+		{name: "ok/upper case", header: "X-CUSTOM-ID", value: "123", wantStatus: http.StatusOK},
+		{name: "ng/lower case", header: "x-custom-id", value: "abc", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mw := WithRequestValidation(MiddlewareOptions{Router: router})
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+			defer srv.Close()
+			req := mustRequest(newRequest(http.MethodGet, srv.URL+"/articles", map[string]string{}, ""))
+			// send the header name as it is without canonicalization
+			req.Header[tc.header] = []string{tc.value}
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWithValidation_enableResponseValidation(t *testing.T) {
+	enabled, disabled := true, false
+	testCases := []struct {
+		name         string
+		enabled      *bool
+		method       string
+		path         string
+		body         string
+		wantStatus   int
+		wantBuffered bool
+	}{
+		{name: "default/response error", enabled: nil, method: http.MethodGet, path: "/users/123", wantStatus: http.StatusInternalServerError, wantBuffered: true},
+		{name: "enabled/response error", enabled: &enabled, method: http.MethodGet, path: "/users/123", wantStatus: http.StatusInternalServerError, wantBuffered: true},
+		{name: "disabled/response error", enabled: &disabled, method: http.MethodGet, path: "/users/123", wantStatus: http.StatusOK, wantBuffered: false},
+		{name: "disabled/request error", enabled: &disabled, method: http.MethodPost, path: "/users", body: `{"name":"aereal","age":"abc"}`, wantStatus: http.StatusBadRequest, wantBuffered: false},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var buffered bool
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, buffered = w.(BufferingResponseWriter)
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "aereal", "age": 17})
+			})
+			mw := WithValidation(MiddlewareOptions{Router: router, EnableResponseValidation: tc.enabled})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(tc.method, srv.URL+tc.path, map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if buffered != tc.wantBuffered {
+				t.Errorf("buffered: got=%t expected=%t", buffered, tc.wantBuffered)
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_discriminatorHeader(t *testing.T) {
+	testCases := []struct {
+		name       string
+		eventType  string
+		body       string
+		wantStatus int
+	}{
+		{name: "mapped/ok", eventType: "registered", body: `{"user":{"id":"123","name":"aereal","age":17}}`, wantStatus: http.StatusNoContent},
+		{name: "mapped/invalid", eventType: "registered", body: `{"userID":"123"}`, wantStatus: http.StatusBadRequest},
+		{name: "schema name/ok", eventType: "UserDeletedEvent", body: `{"userID":"123"}`, wantStatus: http.StatusNoContent},
+		{name: "schema name/invalid", eventType: "UserDeletedEvent", body: `{"user":{"id":"123","name":"aereal","age":17}}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown value", eventType: "updated", body: `{"userID":"123"}`, wantStatus: http.StatusBadRequest},
+		{name: "missing header", eventType: "", body: `{"userID":"123"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+			mw := WithRequestValidation(MiddlewareOptions{Router: router, DiscriminatorHeader: "X-Event-Type"})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			headers := map[string]string{"content-type": "application/json"}
+			if tc.eventType != "" {
+				headers["x-event-type"] = tc.eventType
+			}
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/events", headers, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWithResponseValidation_grpcStatusTrailer(t *testing.T) {
+	testCases := []struct {
+		name       string
+		trailer    string
+		status     string
+		body       string
+		wantStatus int
+	}{
+		{name: "not configured", trailer: "", status: "404", body: `{"message":"not found"}`, wantStatus: http.StatusInternalServerError},
+		{name: "validated as trailer status", trailer: "Grpc-Status", status: "404", body: `{"message":"not found"}`, wantStatus: http.StatusOK},
+		{name: "invalid as trailer status", trailer: "Grpc-Status", status: "200", body: `{"message":"not found"}`, wantStatus: http.StatusInternalServerError},
+		{name: "malformed trailer", trailer: "Grpc-Status", status: "not-found", body: `{"message":"not found"}`, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("trailer", "Grpc-Status")
+				w.Header().Set("content-type", "application/json")
+				w.WriteHeader(http.StatusOK)
+				_, _ = io.WriteString(w, tc.body)
+				w.Header().Set("grpc-status", tc.status)
+			})
+			mw := WithResponseValidation(MiddlewareOptions{Router: router, GrpcStatusTrailer: tc.trailer})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + "/users/123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			_, _ = io.Copy(io.Discard, resp.Body)
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusOK {
+				if got := resp.Trailer.Get("grpc-status"); got != tc.status {
+					t.Errorf("trailer: got=%q expected=%q", got, tc.status)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_debug(t *testing.T) {
+	testCases := []struct {
+		name       string
+		debug      bool
+		options    *openapi3filter.Options
+		wantEvents int
+		wantAttrs  map[string]bool
+	}{
+		{name: "disabled", debug: false, options: &openapi3filter.Options{ExcludeRequestBody: true}, wantEvents: 0},
+		{name: "injected options", debug: true, options: &openapi3filter.Options{ExcludeRequestBody: true, AuthenticationFunc: openapi3filter.NoopAuthenticationFunc}, wantEvents: 1, wantAttrs: map[string]bool{"exclude_request_body": true, "authentication_func": true, "multi_error": false}},
+		{name: "default options", debug: true, options: nil, wantEvents: 1, wantAttrs: map[string]bool{"exclude_request_body": false, "authentication_func": false}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			exporter := tracetest.NewInMemoryExporter()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+			})
+			mw := WithRequestValidation(MiddlewareOptions{Router: router, TracerProvider: tp, ValidationOptions: tc.options, Debug: tc.debug})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, `{"name":"aereal","age":17}`)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("expected one span: %#v", spans)
+			}
+			if len(spans[0].Events) != tc.wantEvents {
+				t.Fatalf("events: got=%d expected=%d", len(spans[0].Events), tc.wantEvents)
+			}
+			if tc.wantEvents == 0 {
+				return
+			}
+			got := map[string]bool{}
+			for _, attr := range spans[0].Events[0].Attributes {
+				got[string(attr.Key)] = attr.Value.AsBool()
+			}
+			for key, want := range tc.wantAttrs {
+				if v, ok := got[key]; !ok || v != want {
+					t.Errorf("attribute %s: got=%v (present=%t) expected=%v", key, v, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_multipleContentTypes(t *testing.T) {
+	multipartBody := func(fields map[string]string) (string, string) {
+		buf := new(bytes.Buffer)
+		mw := multipart.NewWriter(buf)
+		for k, v := range fields {
+			_ = mw.WriteField(k, v)
+		}
+		_ = mw.Close()
+		return buf.String(), mw.FormDataContentType()
+	}
+	validMultipart, validMultipartType := multipartBody(map[string]string{"displayName": "aereal", "website": "https://example.com/"})
+	invalidMultipart, invalidMultipartType := multipartBody(map[string]string{"website": "https://example.com/"})
+	testCases := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{name: "json/ok", contentType: "application/json", body: `{"bio":"hi","tags":["go"]}`, wantStatus: http.StatusNoContent},
+		{name: "json/invalid", contentType: "application/json", body: `{"bio":"hi"}`, wantStatus: http.StatusBadRequest},
+		{name: "multipart/ok", contentType: validMultipartType, body: validMultipart, wantStatus: http.StatusNoContent},
+		{name: "multipart/invalid", contentType: invalidMultipartType, body: invalidMultipart, wantStatus: http.StatusBadRequest},
+		{name: "json body as multipart", contentType: validMultipartType, body: `{"bio":"hi","tags":["go"]}`, wantStatus: http.StatusBadRequest},
+		{name: "multipart body as json", contentType: "application/json", body: validMultipart, wantStatus: http.StatusBadRequest},
+		{name: "undeclared content type", contentType: "text/plain", body: "hi", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+			srv := httptest.NewServer(WithRequestValidation(MiddlewareOptions{Router: router})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/profiles", map[string]string{"content-type": tc.contentType}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWithResponseValidation_handleConditionalRequests(t *testing.T) {
+	testCases := []struct {
+		name        string
+		enabled     bool
+		ifNoneMatch string
+		wantStatus  int
+		wantBody    bool
+	}{
+		{name: "matched", enabled: true, ifNoneMatch: `"v1"`, wantStatus: http.StatusNotModified, wantBody: false},
+		{name: "matched weakly", enabled: true, ifNoneMatch: `"v0", W/"v1"`, wantStatus: http.StatusNotModified, wantBody: false},
+		{name: "not matched", enabled: true, ifNoneMatch: `"v2"`, wantStatus: http.StatusOK, wantBody: true},
+		{name: "no If-None-Match", enabled: true, ifNoneMatch: "", wantStatus: http.StatusOK, wantBody: true},
+		{name: "disabled", enabled: false, ifNoneMatch: `"v1"`, wantStatus: http.StatusOK, wantBody: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("etag", `"v1"`)
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(user{Name: "aereal", Age: 17, ID: "123"})
+			})
+			srv := httptest.NewServer(WithResponseValidation(MiddlewareOptions{Router: router, HandleConditionalRequests: tc.enabled})(handler))
+			defer srv.Close()
+			headers := map[string]string{}
+			if tc.ifNoneMatch != "" {
+				headers["if-none-match"] = tc.ifNoneMatch
+			}
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/users/123", headers, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := len(body) > 0; got != tc.wantBody {
+				t.Errorf("has body: got=%t expected=%t (%q)", got, tc.wantBody, body)
+			}
+			if got := resp.Header.Get("etag"); got != `"v1"` {
+				t.Errorf("ETag: got=%q", got)
+			}
+		})
+	}
+}
+
+func TestWithResponseValidation_forbidUndeclaredResponseHeaders(t *testing.T) {
+	testCases := []struct {
+		name       string
+		forbid     bool
+		allowed    []string
+		headers    map[string]string
+		wantStatus int
+	}{
+		{name: "disabled", forbid: false, headers: map[string]string{"X-Debug": "1"}, wantStatus: http.StatusOK},
+		{name: "undeclared header", forbid: true, headers: map[string]string{"X-Debug": "1"}, wantStatus: http.StatusInternalServerError},
+		{name: "allowed header", forbid: true, allowed: []string{"x-debug"}, headers: map[string]string{"X-Debug": "1"}, wantStatus: http.StatusOK},
+		{name: "infra headers only", forbid: true, headers: map[string]string{"Cache-Control": "no-store"}, wantStatus: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var reported error
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				for k, v := range tc.headers {
+					w.Header().Set(k, v)
+				}
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(user{Name: "aereal", Age: 17, ID: "123"})
+			})
+			mw := WithResponseValidation(MiddlewareOptions{
+				Router:                           router,
+				ForbidUndeclaredResponseHeaders:  tc.forbid,
+				AllowedUndeclaredResponseHeaders: tc.allowed,
+				ReportResponseValidationError: func(w http.ResponseWriter, r *http.Request, err error) {
+					reported = err
+					w.WriteHeader(http.StatusInternalServerError)
+				},
+			})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + "/users/123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusInternalServerError {
+				if reported == nil || !strings.Contains(reported.Error(), "X-Debug") {
+					t.Errorf("expected the error to list X-Debug: %v", reported)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_coerceScalars(t *testing.T) {
+	testCases := []struct {
+		name       string
+		coerce     bool
+		query      string
+		wantStatus int
+	}{
+		{name: "boolean/1", coerce: true, query: "active=1", wantStatus: http.StatusOK},
+		{name: "boolean/yes", coerce: true, query: "active=yes", wantStatus: http.StatusOK},
+		{name: "boolean/off", coerce: true, query: "active=off", wantStatus: http.StatusOK},
+		{name: "integer/quoted", coerce: true, query: "count=%225%22", wantStatus: http.StatusOK},
+		{name: "integer array/quoted", coerce: true, query: "tags=%221%22,2", wantStatus: http.StatusOK},
+		{name: "not coercible", coerce: true, query: "count=five", wantStatus: http.StatusBadRequest},
+		{name: "disabled/boolean", coerce: false, query: "active=yes", wantStatus: http.StatusBadRequest},
+		{name: "disabled/integer", coerce: false, query: "count=%225%22", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var gotRawQuery string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRawQuery = r.URL.RawQuery
+				w.WriteHeader(http.StatusOK)
+			})
+			srv := httptest.NewServer(WithRequestValidation(MiddlewareOptions{Router: router, CoerceScalars: tc.coerce})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + "/articles?" + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			// the next handler receives the query as it is sent
+			if tc.wantStatus == http.StatusOK && gotRawQuery != tc.query {
+				t.Errorf("query: got=%q expected=%q", gotRawQuery, tc.query)
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_escapedPathParams(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromFile("./testdata/user-account-service.openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyRouter, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		router     routers.Router
+		path       string
+		wantStatus int
+	}{
+		{name: "gorillamux/encoded slash", router: router, path: "/files/a%2Fb", wantStatus: http.StatusOK},
+		{name: "gorillamux/encoded percent", router: router, path: "/users/12%2533", wantStatus: http.StatusBadRequest},
+		{name: "legacy/plain", router: legacyRouter, path: "/users/123", wantStatus: http.StatusOK},
+		// the value is "12%33" that must not be decoded into "123" again
+		{name: "legacy/encoded percent", router: legacyRouter, path: "/users/12%2533", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+			srv := httptest.NewServer(WithRequestValidation(MiddlewareOptions{Router: tc.router})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				body, _ := io.ReadAll(resp.Body)
+				t.Errorf("StatusCode: got=%d expected=%d (%s)", resp.StatusCode, tc.wantStatus, body)
+			}
+		})
+	}
+}
+
+type countingRouter struct {
+	routers.Router
+	count int32
+}
+
+func (r *countingRouter) FindRoute(req *http.Request) (*routers.Route, map[string]string, error) {
+	atomic.AddInt32(&r.count, 1)
+	return r.Router.FindRoute(req)
+}
+
+func TestWithValidation_findRouteOnce(t *testing.T) {
+	testCases := []struct {
+		name  string
+		build func(options MiddlewareOptions) Middleware
+	}{
+		{name: "WithValidation", build: WithValidation},
+		{name: "request layer outside", build: func(options MiddlewareOptions) Middleware {
+			return func(next http.Handler) http.Handler {
+				return WithRequestValidation(options)(WithResponseValidation(options)(next))
+			}
+		}},
+		{name: "response layer outside", build: func(options MiddlewareOptions) Middleware {
+			return func(next http.Handler) http.Handler {
+				return WithResponseValidation(options)(WithRequestValidation(options)(next))
+			}
+		}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cr := &countingRouter{Router: router}
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(user{Name: "aereal", Age: 17, ID: "123"})
+			})
+			srv := httptest.NewServer(tc.build(MiddlewareOptions{Router: cr})(handler))
+			defer srv.Close()
+			for i := 1; i <= 2; i++ {
+				resp, err := srv.Client().Get(srv.URL + "/users/123")
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK {
+					t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, http.StatusOK)
+				}
+				if got := atomic.LoadInt32(&cr.count); got != int32(i) {
+					t.Errorf("FindRoute calls after %d requests: got=%d", i, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWithResponseValidation_validateResponseStatuses(t *testing.T) {
+	testCases := []struct {
+		name       string
+		validates  func(status int) bool
+		status     int
+		body       string
+		wantStatus int
+		wantStream bool
+		earlyHints bool
+	}{
+		{name: "2xx/validated", validates: Only2xx, status: http.StatusOK, body: `{"name":"aereal","age":17}`, wantStatus: http.StatusInternalServerError, wantStream: false},
+		{name: "4xx/not validated", validates: Only2xx, status: http.StatusNotFound, body: `{"message":["not found"]}`, wantStatus: http.StatusNotFound, wantStream: true},
+		{name: "5xx/not validated", validates: Only2xx, status: http.StatusServiceUnavailable, body: `unavailable`, wantStatus: http.StatusServiceUnavailable, wantStream: true},
+		{name: "2xx after early hints/validated", validates: Only2xx, status: http.StatusOK, body: `{"name":"aereal","age":17}`, wantStatus: http.StatusInternalServerError, wantStream: false, earlyHints: true},
+		{name: "4xx after early hints/not validated", validates: Only2xx, status: http.StatusNotFound, body: `{"message":["not found"]}`, wantStatus: http.StatusNotFound, wantStream: true, earlyHints: true},
+		{name: "nil/every status validated", validates: nil, status: http.StatusOK, body: `{"name":"aereal","age":17}`, wantStatus: http.StatusInternalServerError, wantStream: false},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			received := make(chan struct{})
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tc.earlyHints {
+					w.Header().Set("link", "</style.css>; rel=preload; as=style")
+					w.WriteHeader(http.StatusEarlyHints)
+				}
+				w.Header().Set("content-type", "application/json")
+				w.WriteHeader(tc.status)
+				_, _ = io.WriteString(w, tc.body)
+				if !tc.wantStream {
+					return
+				}
+				w.(http.Flusher).Flush()
+				// the client receives the response before the handler returns
+				select {
+				case <-received:
+				case <-time.After(time.Second):
+					t.Error("the response is not streamed")
+				}
+			})
+			srv := httptest.NewServer(WithResponseValidation(MiddlewareOptions{Router: router, ValidateResponseStatuses: tc.validates})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + "/users/123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if !tc.wantStream {
+				return
+			}
+			body := make([]byte, len(tc.body))
+			if _, err := io.ReadFull(resp.Body, body); err != nil {
+				t.Fatal(err)
+			}
+			close(received)
+			if string(body) != tc.body {
+				t.Errorf("body: got=%q expected=%q", body, tc.body)
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_contentTypeAliases(t *testing.T) {
+	testCases := []struct {
+		name        string
+		aliases     map[string]string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{name: "aliased/ok", aliases: map[string]string{"text/plain": "application/json"}, contentType: "text/plain; charset=utf-8", body: `{"name":"aereal","age":17}`, wantStatus: http.StatusCreated},
+		{name: "aliased/invalid", aliases: map[string]string{"text/plain": "application/json"}, contentType: "text/plain", body: `{"name":"aereal","age":"abc"}`, wantStatus: http.StatusBadRequest},
+		{name: "not aliased", aliases: nil, contentType: "text/plain", body: `{"name":"aereal","age":17}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var gotContentType string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotContentType = r.Header.Get("content-type")
+				w.WriteHeader(http.StatusCreated)
+			})
+			srv := httptest.NewServer(WithRequestValidation(MiddlewareOptions{Router: router, ContentTypeAliases: tc.aliases})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": tc.contentType}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusCreated && gotContentType != tc.contentType {
+				t.Errorf("Content-Type: got=%q expected=%q", gotContentType, tc.contentType)
+			}
+		})
+	}
+}
+
+func TestWithValidation_routeResolvedOnce(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	cr := &countingRouter{Router: router}
+	sinkResults := make(chan ValidationResult, 1)
+	sink := NewErrorSink(func(_ context.Context, result ValidationResult) { sinkResults <- result }, 1)
+	defer func() { _ = sink.Shutdown(context.Background()) }()
+	var handlerOperationID string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if route, ok := RouteFromContext(r.Context()); ok {
+			handlerOperationID = route.Operation.OperationID
+		}
+		w.Header().Set("content-type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "aereal", "age": 17})
+	})
+	mw := WithValidation(MiddlewareOptions{Router: cr, TracerProvider: tp, AsyncErrorSink: sink})
+	srv := httptest.NewServer(mw(handler))
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/users/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, http.StatusInternalServerError)
+	}
+	if got := atomic.LoadInt32(&cr.count); got != 1 {
+		t.Errorf("FindRoute calls: got=%d expected=1", got)
+	}
+	const wantOperationID = "getUser"
+	if handlerOperationID != wantOperationID {
+		t.Errorf("operation ID in the context: got=%q expected=%q", handlerOperationID, wantOperationID)
+	}
+	select {
+	case result := <-sinkResults:
+		if result.Route == nil || result.Route.Operation.OperationID != wantOperationID {
+			t.Errorf("operation ID in the sink: got=%#v", result.Route)
+		}
+	case <-time.After(time.Second):
+		t.Error("no validation result is sent to the sink")
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans: %d", len(spans))
+	}
+	for _, span := range spans {
+		var got string
+		for _, attr := range span.Attributes {
+			if attr.Key == "openapi.operation_id" {
+				got = attr.Value.AsString()
+			}
+		}
+		if got != wantOperationID {
+			t.Errorf("operation ID in the span %s: got=%q expected=%q", span.Name, got, wantOperationID)
+		}
+	}
+}
+
+func TestWithValidation_observeRequestEnforceResponse(t *testing.T) {
+	responseOutside := func(options MiddlewareOptions) Middleware {
+		return func(next http.Handler) http.Handler {
+			return WithResponseValidation(options)(WithRequestValidation(options)(next))
+		}
+	}
+	testCases := []struct {
+		name            string
+		build           func(options MiddlewareOptions) Middleware
+		response        interface{}
+		wantStatus      int
+		wantPhase       ValidationPhase
+		wantObserved    bool
+		wantRequestErr  bool
+		wantResponseErr bool
+	}{
+		{name: "both failed", build: WithValidation, response: map[string]interface{}{"name": "aereal"}, wantStatus: http.StatusInternalServerError, wantPhase: PhaseResponse, wantObserved: false, wantRequestErr: true, wantResponseErr: true},
+		{name: "both failed/response layer outside", build: responseOutside, response: map[string]interface{}{"name": "aereal"}, wantStatus: http.StatusInternalServerError, wantPhase: PhaseResponse, wantObserved: false, wantRequestErr: true, wantResponseErr: true},
+		{name: "only request failed", build: WithValidation, response: user{ID: "123", Name: "aereal", Age: 17}, wantStatus: http.StatusOK, wantPhase: PhaseRequest, wantObserved: true},
+		{name: "only request failed/request layer only", build: WithRequestValidation, response: map[string]interface{}{"name": "aereal"}, wantStatus: http.StatusOK, wantPhase: PhaseRequest, wantObserved: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			results := make(chan ValidationResult, 2)
+			sink := NewErrorSink(func(_ context.Context, result ValidationResult) { results <- result }, 2)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(tc.response)
+			})
+			mw := tc.build(MiddlewareOptions{Router: router, RequestMode: Observe, ResponseMode: Enforce, AsyncErrorSink: sink})
+			srv := httptest.NewServer(mw(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, `{"name":"aereal","age":"abc"}`)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if err := sink.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			close(results)
+			var got []ValidationResult
+			for result := range results {
+				got = append(got, result)
+			}
+			if len(got) != 1 {
+				t.Fatalf("expected one combined result: %#v", got)
+			}
+			result := got[0]
+			if result.Phase != tc.wantPhase {
+				t.Errorf("Phase: got=%s expected=%s", result.Phase, tc.wantPhase)
+			}
+			if result.Observed != tc.wantObserved {
+				t.Errorf("Observed: got=%t expected=%t", result.Observed, tc.wantObserved)
+			}
+			if tc.wantResponseErr {
+				if responseErr := new(openapi3filter.ResponseError); !errors.As(result.Err, &responseErr) {
+					t.Errorf("Err: expected the response error but got %#v", result.Err)
+				}
+			} else if requestErr := new(openapi3filter.RequestError); !errors.As(result.Err, &requestErr) {
+				t.Errorf("Err: expected the request error but got %#v", result.Err)
+			}
+			if tc.wantRequestErr {
+				if requestErr := new(openapi3filter.RequestError); !errors.As(result.RequestErr, &requestErr) {
+					t.Errorf("RequestErr: expected the request error but got %#v", result.RequestErr)
+				}
+			}
+		})
+	}
+}
+
+func TestWithResponseValidation_head(t *testing.T) {
+	testCases := []struct {
+		name       string
+		version    string
+		wantStatus int
+	}{
+		{name: "ok", version: "3", wantStatus: http.StatusOK},
+		{name: "invalid header", version: "abc", wantStatus: http.StatusInternalServerError},
+		{name: "missing header", version: "", wantStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var written int
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tc.version != "" {
+					w.Header().Set("x-user-version", tc.version)
+				}
+				w.Header().Set("content-type", "application/json")
+				// the handler written for GET writes the body that does not conform to the schema
+				written, _ = io.WriteString(w, `{"name":"aereal"}`)
+			})
+			srv := httptest.NewServer(WithResponseValidation(MiddlewareOptions{Router: router})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Head(srv.URL + "/users/123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if written == 0 {
+				t.Error("the handler is expected to write the body")
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(body) != 0 {
+				t.Errorf("body must not be sent: %q", body)
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_parameterMapper(t *testing.T) {
+	mapper := func(r *http.Request) map[string]string {
+		values := map[string]string{}
+		if v := r.Header.Get("grpc-metadata-count"); v != "" {
+			values["count"] = v
+		}
+		return values
 	}
-	expectedBody, _ := io.ReadAll(expected.Body)
-	gotBody, _ := io.ReadAll(got.Body)
-	defer func() {
-		// rewind body
-		expected.Body = io.NopCloser(bytes.NewReader(expectedBody))
-		got.Body = io.NopCloser(bytes.NewReader(gotBody))
-	}()
-	if string(expectedBody) != string(gotBody) {
-		return fmt.Errorf("body:\ngot=%s\nexpected=%s", gotBody, expectedBody)
+	testCases := []struct {
+		name       string
+		mapper     func(r *http.Request) map[string]string
+		headers    map[string]string
+		query      string
+		wantStatus int
+	}{
+		{name: "mapped/ok", mapper: mapper, headers: map[string]string{"grpc-metadata-count": "5"}, wantStatus: http.StatusOK},
+		{name: "mapped/invalid", mapper: mapper, headers: map[string]string{"grpc-metadata-count": "five"}, wantStatus: http.StatusBadRequest},
+		{name: "mapped/overrides query", mapper: mapper, headers: map[string]string{"grpc-metadata-count": "five"}, query: "count=5", wantStatus: http.StatusBadRequest},
+		{name: "not mapped", mapper: nil, headers: map[string]string{"grpc-metadata-count": "five"}, wantStatus: http.StatusOK},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var gotQuery string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotQuery = r.URL.RawQuery
+				w.WriteHeader(http.StatusOK)
+			})
+			srv := httptest.NewServer(WithRequestValidation(MiddlewareOptions{Router: router, ParameterMapper: tc.mapper})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/articles?"+tc.query, tc.headers, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			if tc.wantStatus == http.StatusOK && gotQuery != tc.query {
+				t.Errorf("the next handler must receive the query as it is sent: got=%q expected=%q", gotQuery, tc.query)
+			}
+		})
+	}
+}
+
+func TestWithValidation_bodySize(t *testing.T) {
+	testCases := []struct {
+		name                string
+		responseBody        string
+		wantStatus          int
+		wantResponseOutcome string
+	}{
+		{name: "valid", responseBody: `{"id":"123","name":"aereal","age":17}` + "\n", wantStatus: http.StatusOK, wantResponseOutcome: "valid"},
+		{name: "invalid response", responseBody: `{"name":"aereal","age":17}` + "\n", wantStatus: http.StatusInternalServerError, wantResponseOutcome: "invalid"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mp := &recordingMeterProvider{}
+			requestBody := `{"name":"aereal","age":17}`
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_, _ = io.WriteString(w, tc.responseBody)
+			})
+			srv := httptest.NewServer(WithValidation(MiddlewareOptions{Router: router, MeterProvider: mp})(handler))
+			defer srv.Close()
+			req := mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, requestBody))
+			// send the body chunked so that the size is counted from the body
+			req.ContentLength = -1
+			resp, err := srv.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.wantStatus {
+				t.Fatalf("StatusCode: got=%d expected=%d (%s)", resp.StatusCode, tc.wantStatus, got)
+			}
+			want := map[string][]string{
+				"openapi.request.body_size":  {fmt.Sprintf("valid %d", len(requestBody))},
+				"openapi.response.body_size": {fmt.Sprintf("%s %d", tc.wantResponseOutcome, len(tc.responseBody))},
+			}
+			recorded := mp.recorded()
+			if !reflect.DeepEqual(recorded, want) {
+				t.Errorf("body sizes: got=%v expected=%v", recorded, want)
+			}
+		})
+	}
+}
+
+type recordingMeterProvider struct {
+	noop.MeterProvider
+	mu      sync.Mutex
+	records map[string][]string
+}
+
+func (mp *recordingMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return recordingMeter{mp: mp}
+}
+
+func (mp *recordingMeterProvider) recorded() map[string][]string {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+	return mp.records
+}
+
+type recordingMeter struct {
+	noop.Meter
+	mp *recordingMeterProvider
+}
+
+func (m recordingMeter) Int64Histogram(name string, _ ...metric.Int64HistogramOption) (metric.Int64Histogram, error) {
+	return recordingHistogram{mp: m.mp, name: name}, nil
+}
+
+// recordingHistogram records the values with the outcome attribute in the form of "<outcome> <value>".
+type recordingHistogram struct {
+	noop.Int64Histogram
+	mp   *recordingMeterProvider
+	name string
+}
+
+func (h recordingHistogram) Record(_ context.Context, value int64, opts ...metric.RecordOption) {
+	attrs := metric.NewRecordConfig(opts).Attributes()
+	outcome, _ := attrs.Value("openapi.validation.outcome")
+	h.mp.mu.Lock()
+	defer h.mp.mu.Unlock()
+	if h.mp.records == nil {
+		h.mp.records = map[string][]string{}
+	}
+	h.mp.records[h.name] = append(h.mp.records[h.name], fmt.Sprintf("%s %d", outcome.AsString(), value))
+}
+
+func TestWithResponseValidation_postTransform(t *testing.T) {
+	removeField := func(name string) func([]byte) []byte {
+		return func(body []byte) []byte {
+			var v map[string]interface{}
+			if err := json.Unmarshal(body, &v); err != nil {
+				return body
+			}
+			delete(v, name)
+			transformed, _ := json.Marshal(v)
+			return transformed
+		}
+	}
+	testCases := []struct {
+		name       string
+		transform  func([]byte) []byte
+		setLength  bool
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "no transform", transform: nil, setLength: true, wantStatus: http.StatusOK, wantBody: `{"age":17,"debug":"trace","id":"123","name":"aereal"}`},
+		{name: "remove optional field", transform: removeField("debug"), setLength: true, wantStatus: http.StatusOK, wantBody: `{"age":17,"id":"123","name":"aereal"}`},
+		{name: "remove optional field without content-length", transform: removeField("debug"), setLength: false, wantStatus: http.StatusOK, wantBody: `{"age":17,"id":"123","name":"aereal"}`},
+		{name: "remove required field", transform: removeField("age"), setLength: true, wantStatus: http.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				body, _ := json.Marshal(map[string]interface{}{"id": "123", "name": "aereal", "age": 17, "debug": "trace"})
+				w.Header().Set("content-type", "application/json")
+				if tc.setLength {
+					w.Header().Set("content-length", strconv.Itoa(len(body)))
+				}
+				_, _ = w.Write(body)
+			})
+			var writers int
+			factory := func(w http.ResponseWriter) BufferingResponseWriter {
+				writers++
+				return NewBufferingResponseWriter(w)
+			}
+			srv := httptest.NewServer(WithResponseValidation(MiddlewareOptions{Router: router, PostTransform: tc.transform, ResponseWriterFactory: factory})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + "/users/123")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			// the transformed body replaces the body of the writer of the factory
+			if writers != 1 {
+				t.Errorf("writers: got=%d expected=1", writers)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantBody == "" {
+				// the error response is not truncated by Content-Length of the discarded body
+				var payload map[string]interface{}
+				if err := json.Unmarshal(got, &payload); err != nil {
+					t.Errorf("error body: %v (%q)", err, got)
+				}
+				return
+			}
+			if string(got) != tc.wantBody {
+				t.Errorf("body: got=%s expected=%s", got, tc.wantBody)
+			}
+			if resp.ContentLength != int64(len(tc.wantBody)) {
+				t.Errorf("ContentLength: got=%d expected=%d", resp.ContentLength, len(tc.wantBody))
+			}
+		})
+	}
+}
+
+func TestWithRequestValidation_strictNumbers(t *testing.T) {
+	testCases := []struct {
+		name       string
+		strict     bool
+		body       string
+		wantStatus int
+	}{
+		{name: "strict/int32 maximum", strict: true, body: `{"name":"aereal","age":17,"score":2147483647}`, wantStatus: http.StatusCreated},
+		{name: "strict/int32 overflow", strict: true, body: `{"name":"aereal","age":17,"score":2147483648}`, wantStatus: http.StatusBadRequest},
+		{name: "strict/int32 minimum", strict: true, body: `{"name":"aereal","age":17,"score":-2147483648}`, wantStatus: http.StatusCreated},
+		{name: "strict/int32 underflow", strict: true, body: `{"name":"aereal","age":17,"score":-2147483649}`, wantStatus: http.StatusBadRequest},
+		{name: "strict/int32 with fraction part", strict: true, body: `{"name":"aereal","age":17,"score":1.0}`, wantStatus: http.StatusCreated},
+		{name: "strict/int32 with exponent", strict: true, body: `{"name":"aereal","age":17,"score":1e3}`, wantStatus: http.StatusCreated},
+		{name: "strict/int32 overflow with fraction part", strict: true, body: `{"name":"aereal","age":17,"score":2147483648.0}`, wantStatus: http.StatusBadRequest},
+		{name: "strict/int64 in range", strict: true, body: `{"name":"aereal","age":17,"followers":9223372036854775807}`, wantStatus: http.StatusCreated},
+		{name: "strict/int64 overflow", strict: true, body: `{"name":"aereal","age":17,"followers":9223372036854775808}`, wantStatus: http.StatusBadRequest},
+		{name: "not strict/int64 overflow", strict: false, body: `{"name":"aereal","age":17,"followers":9223372036854775808}`, wantStatus: http.StatusCreated},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var gotBody string
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				gotBody = string(b)
+				w.WriteHeader(http.StatusCreated)
+			})
+			srv := httptest.NewServer(WithRequestValidation(MiddlewareOptions{Router: router, StrictNumbers: tc.strict})(handler))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d (%s)", resp.StatusCode, tc.wantStatus, body)
+			}
+			if tc.wantStatus == http.StatusBadRequest && !strings.Contains(string(body), `"code":"FORMAT"`) {
+				t.Errorf("expected the format error: %s", body)
+			}
+			if tc.wantStatus == http.StatusCreated && gotBody == "" {
+				t.Error("the next handler must receive the body")
+			}
+		})
+	}
+}
+
+func resumeResponse(testName string, got *http.Response) (*http.Response, error) {
+	path := goldenResponsePath("./testdata", testName)
+	imported, err := readGoldenResponse(path)
+	if err == nil {
+		return imported, nil
+	}
+	// skip ErrNotExist
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
 	}
-	if err := testHTTPHeader(expected.Header, got.Header); err != nil {
-		return err
+	if err := writeGoldenResponse(path, got); err != nil {
+		return nil, err
 	}
-	return nil
+	return got, nil
 }
 
-func testHTTPHeader(expected, got http.Header) error {
-	excludes := map[string]bool{"Date": true}
-	expectedBuf := new(bytes.Buffer)
-	gotBuf := new(bytes.Buffer)
-	if err := expected.WriteSubset(expectedBuf, excludes); err != nil {
-		return err
+func mustRequest(r *http.Request, err error) *http.Request {
+	if err != nil {
+		panic(err)
 	}
-	if err := got.WriteSubset(gotBuf, excludes); err != nil {
-		return err
+	return r
+}
+
+func newRequest(method, path string, headers map[string]string, body string) (*http.Request, error) {
+	req, err := http.NewRequest(method, path, strings.NewReader((body)))
+	if err != nil {
+		return nil, err
 	}
-	if expectedBuf.String() != gotBuf.String() {
-		return fmt.Errorf("got=%q expected=%q", gotBuf.String(), expectedBuf.String())
+	for k, v := range headers {
+		req.Header.Set(k, v)
 	}
-	return nil
+	return req, nil
 }
@@ -0,0 +1,88 @@
+package openapi3middleware
+
+import "context"
+
+// ValidationMode controls how the middleware behaves on validation failures.
+type ValidationMode int
+
+const (
+	// Enforce reports validation failures to the client with the reporters of MiddlewareOptions.
+	Enforce ValidationMode = iota
+	// Observe only records validation failures in the span and passes through the request or the response.
+	Observe
+)
+
+func (m ValidationMode) String() string {
+	switch m {
+	case Enforce:
+		return "Enforce"
+	case Observe:
+		return "Observe"
+	default:
+		return "ValidationMode(unknown)"
+	}
+}
+
+type responseModeKey struct{}
+
+// WithResponseMode returns a new context that overrides MiddlewareOptions.ResponseMode for the request.
+//
+// It is intended to be used by the middleware that precedes WithResponseValidation such as a canary release.
+func WithResponseMode(ctx context.Context, mode ValidationMode) context.Context {
+	return context.WithValue(ctx, responseModeKey{}, mode)
+}
+
+func responseModeFromContext(ctx context.Context) (ValidationMode, bool) {
+	mode, ok := ctx.Value(responseModeKey{}).(ValidationMode)
+	return mode, ok
+}
+
+type requestModeKey struct{}
+
+// WithRequestMode returns a new context that overrides MiddlewareOptions.RequestMode for the request.
+func WithRequestMode(ctx context.Context, mode ValidationMode) context.Context {
+	return context.WithValue(ctx, requestModeKey{}, mode)
+}
+
+func requestModeFromContext(ctx context.Context) (ValidationMode, bool) {
+	mode, ok := ctx.Value(requestModeKey{}).(ValidationMode)
+	return mode, ok
+}
+
+type observationKey struct{}
+
+// observation holds the failures observed in a request that every layer shares.
+type observation struct {
+	// responsePending reports whether the response validation follows and delivers the observed failures with its result.
+	responsePending bool
+	request         *ValidationResult
+}
+
+// withObservation returns the context that holds the observation of the request.
+// The context that already holds one is returned as it is so that every layer shares it.
+func withObservation(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(observationKey{}).(*observation); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, observationKey{}, new(observation))
+}
+
+func observationFromContext(ctx context.Context) *observation {
+	if obs, ok := ctx.Value(observationKey{}).(*observation); ok {
+		return obs
+	}
+	return new(observation)
+}
+
+func (obs *observation) observeRequest(result ValidationResult) {
+	if obs.request == nil {
+		obs.request = &result
+	}
+}
+
+// takeRequest returns the observed failure of the request validation that is not delivered yet.
+func (obs *observation) takeRequest() *ValidationResult {
+	result := obs.request
+	obs.request = nil
+	return result
+}
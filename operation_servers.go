@@ -0,0 +1,80 @@
+package openapi3middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// NewOperationServersRouter returns a router that honors the servers declared on each operation,
+// which routers provided by kin-openapi ignore.
+//
+// The operations that declare their own servers are routed only with those servers,
+// and the other requests are routed by fallback.
+func NewOperationServersRouter(doc *openapi3.T, fallback routers.Router) (routers.Router, error) {
+	or := &operationServersRouter{fallback: fallback}
+	for _, path := range doc.Paths.InMatchingOrder() {
+		pathItem := doc.Paths.Value(path)
+		for method, op := range pathItem.Operations() {
+			if op.Servers == nil || len(*op.Servers) == 0 {
+				continue
+			}
+			item := new(openapi3.PathItem)
+			item.SetOperation(method, op)
+			sub := &openapi3.T{
+				OpenAPI:    doc.OpenAPI,
+				Info:       doc.Info,
+				Components: doc.Components,
+				Servers:    *op.Servers,
+				Paths:      openapi3.NewPaths(openapi3.WithPath(path, item)),
+			}
+			r, err := gorillamux.NewRouter(sub)
+			if err != nil {
+				return nil, fmt.Errorf("gorillamux.NewRouter(%s %s): %w", method, path, err)
+			}
+			or.routers = append(or.routers, operationRouter{router: r, spec: doc, pathItem: pathItem})
+		}
+	}
+	return or, nil
+}
+
+type operationRouter struct {
+	router   routers.Router
+	spec     *openapi3.T
+	pathItem *openapi3.PathItem
+}
+
+type operationServersRouter struct {
+	routers  []operationRouter
+	fallback routers.Router
+}
+
+var _ routers.Router = &operationServersRouter{}
+
+func (or *operationServersRouter) FindRoute(r *http.Request) (*routers.Route, map[string]string, error) {
+	for _, opr := range or.routers {
+		route, pathParams, err := opr.router.FindRoute(r)
+		if errors.Is(err, routers.ErrPathNotFound) || errors.Is(err, routers.ErrMethodNotAllowed) {
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		route.Spec = opr.spec
+		route.PathItem = opr.pathItem
+		return route, pathParams, nil
+	}
+	route, pathParams, err := or.fallback.FindRoute(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if op := route.Operation; op != nil && op.Servers != nil && len(*op.Servers) > 0 {
+		// the operation is not served on the servers of the document or the path
+		return nil, nil, routers.ErrPathNotFound
+	}
+	return route, pathParams, nil
+}
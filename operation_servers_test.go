@@ -0,0 +1,61 @@
+package openapi3middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+func TestNewOperationServersRouter(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromFile("./testdata/operation-servers.openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opRouter, err := NewOperationServersRouter(doc, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{name: "ok/document server", method: http.MethodGet, path: "/v1/users/123", wantStatus: http.StatusOK},
+		{name: "ng/document server", method: http.MethodGet, path: "/v1/users/abc", wantStatus: http.StatusBadRequest},
+		{name: "ok/operation server", method: http.MethodPost, path: "/v2/users", body: `{"name":"aereal"}`, wantStatus: http.StatusOK},
+		{name: "ng/operation server", method: http.MethodPost, path: "/v2/users", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "ng/operation not served on document server", method: http.MethodPost, path: "/v1/users", body: `{"name":"aereal"}`, wantStatus: http.StatusNotFound},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mw := WithRequestValidation(MiddlewareOptions{
+				Router: opRouter,
+				ReportFindRouteError: func(w http.ResponseWriter, r *http.Request, err error) {
+					w.WriteHeader(http.StatusNotFound)
+				},
+			})
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(tc.method, srv.URL+tc.path, map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package openapi3middleware
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// mapParameters sets the values to the parameters of the route that have the names in their canonical locations.
+//
+// It returns the function that restores the query and the headers of the request so that the next handler receives them as they are sent.
+func mapParameters(input *openapi3filter.RequestValidationInput, values map[string]string) func() {
+	noop := func() {}
+	route := input.Route
+	if len(values) == 0 || route == nil {
+		return noop
+	}
+	var params openapi3.Parameters
+	if route.PathItem != nil {
+		params = append(params, route.PathItem.Parameters...)
+	}
+	if route.Operation != nil {
+		params = append(params, route.Operation.Parameters...)
+	}
+	r := input.Request
+	var (
+		originalQuery  = r.URL.RawQuery
+		originalHeader = r.Header
+		query          = r.URL.Query()
+		header         http.Header
+		queryModified  bool
+	)
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param := params.GetByInAndName(openapi3.ParameterInQuery, name)
+		if param != nil {
+			query.Set(name, values[name])
+			queryModified = true
+			continue
+		}
+		if param = params.GetByInAndName(openapi3.ParameterInHeader, name); param != nil {
+			if header == nil {
+				header = r.Header.Clone()
+			}
+			header.Set(name, values[name])
+			continue
+		}
+		if param = params.GetByInAndName(openapi3.ParameterInPath, name); param != nil {
+			if input.PathParams == nil {
+				input.PathParams = map[string]string{}
+			}
+			input.PathParams[name] = values[name]
+		}
+	}
+	if queryModified {
+		r.URL.RawQuery = query.Encode()
+	}
+	if header != nil {
+		r.Header = header
+	}
+	return func() {
+		r.URL.RawQuery = originalQuery
+		r.Header = originalHeader
+	}
+}
@@ -0,0 +1,75 @@
+package openapi3middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// ReportProblemJSON is a reporter that responds an RFC 7807 problem document which has invalid-params member.
+//
+// Each entry of invalid-params has the JSON pointer to the failing field of the body (or the name of the failing parameter) and the reason.
+// It reports every failure if openapi3filter.Options.MultiError is enabled.
+//
+// It can be used as any of MiddlewareOptions.ReportRequestValidationError and MiddlewareOptions.ReportResponseValidationError.
+func ReportProblemJSON(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusInternalServerError
+	if requestErr := new(openapi3filter.RequestError); errors.As(err, &requestErr) {
+		status = http.StatusBadRequest
+	}
+	doc := problem{
+		Type:          "about:blank",
+		Title:         http.StatusText(status),
+		Status:        status,
+		Detail:        err.Error(),
+		InvalidParams: collectInvalidParams(err),
+	}
+	w.Header().Set("content-type", "application/problem+json")
+	w.Header().Del("content-encoding")
+	w.Header().Del("content-length")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(doc)
+}
+
+type problem struct {
+	Type          string         `json:"type"`
+	Title         string         `json:"title"`
+	Status        int            `json:"status"`
+	Detail        string         `json:"detail,omitempty"`
+	InvalidParams []invalidParam `json:"invalid-params,omitempty"`
+}
+
+type invalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+func collectInvalidParams(err error) []invalidParam {
+	var params []invalidParam
+	walkValidationErrors(err, func(failure validationFailure) {
+		params = append(params, invalidParam{Name: failure.field(), Reason: failure.reason})
+	})
+	return params
+}
+
+func parameterName(param *openapi3.Parameter) string {
+	if param == nil {
+		return ""
+	}
+	return param.Name
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func toJSONPointer(tokens []string) string {
+	b := new(strings.Builder)
+	for _, token := range tokens {
+		b.WriteString("/")
+		b.WriteString(jsonPointerEscaper.Replace(token))
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package openapi3middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+func TestReportProblemJSON(t *testing.T) {
+	testCases := []struct {
+		name              string
+		validationOptions *openapi3filter.Options
+		body              string
+		want              problem
+	}{
+		{
+			name:              "multiple errors",
+			validationOptions: &openapi3filter.Options{MultiError: true},
+			body:              `{"name":1,"age":"abc"}`,
+			want: problem{
+				Type:   "about:blank",
+				Title:  "Bad Request",
+				Status: http.StatusBadRequest,
+				InvalidParams: []invalidParam{
+					{Name: "/age", Reason: "value must be an integer"},
+					{Name: "/name", Reason: "value must be a string"},
+				},
+			},
+		},
+		{
+			name: "single error",
+			body: `{"name":1,"age":17}`,
+			want: problem{
+				Type:   "about:blank",
+				Title:  "Bad Request",
+				Status: http.StatusBadRequest,
+				InvalidParams: []invalidParam{
+					{Name: "/name", Reason: "value must be a string"},
+				},
+			},
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mw := WithRequestValidation(MiddlewareOptions{
+				Router:                       router,
+				ValidationOptions:            tc.validationOptions,
+				ReportRequestValidationError: ReportProblemJSON,
+			})
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				panic("should not reach here")
+			})))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodPost, srv.URL+"/users", map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if ct := resp.Header.Get("content-type"); ct != "application/problem+json" {
+				t.Errorf("content-type: got=%q", ct)
+			}
+			var got problem
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			got.Detail = ""
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("problem:\ngot=%#v\nexpected=%#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package openapi3middleware
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// infraResponseHeaders are the headers that the servers and the proxies set regardless of the spec.
+var infraResponseHeaders = []string{
+	"Age",
+	"Cache-Control",
+	"Connection",
+	"Content-Encoding",
+	"Content-Length",
+	"Content-Type",
+	"Date",
+	"Etag",
+	"Expires",
+	"Keep-Alive",
+	"Last-Modified",
+	"Server",
+	"Strict-Transport-Security",
+	"Trailer",
+	"Transfer-Encoding",
+	"Vary",
+	"X-Content-Type-Options",
+}
+
+// checkUndeclaredResponseHeaders returns the error that lists the response headers that the spec does not declare.
+//
+// The infrastructure headers and the allowed headers are not reported.
+func checkUndeclaredResponseHeaders(input *openapi3filter.ResponseValidationInput, allowed []string) error {
+	route := input.RequestValidationInput.Route
+	if route == nil || route.Operation == nil || route.Operation.Responses == nil {
+		return nil
+	}
+	responses := route.Operation.Responses
+	responseRef := responses.Status(input.Status)
+	if responseRef == nil {
+		responseRef = responses.Default()
+	}
+	if responseRef == nil || responseRef.Value == nil {
+		return nil
+	}
+	declared := map[string]bool{}
+	for _, name := range infraResponseHeaders {
+		declared[http.CanonicalHeaderKey(name)] = true
+	}
+	for _, name := range allowed {
+		declared[http.CanonicalHeaderKey(name)] = true
+	}
+	for name := range responseRef.Value.Headers {
+		declared[http.CanonicalHeaderKey(name)] = true
+	}
+	var undeclared []string
+	for name := range input.Header {
+		if strings.HasPrefix(name, http.TrailerPrefix) || declared[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		undeclared = append(undeclared, name)
+	}
+	if len(undeclared) == 0 {
+		return nil
+	}
+	sort.Strings(undeclared)
+	return &openapi3filter.ResponseError{
+		Input:  input,
+		Reason: "response has headers not declared in the spec: " + strings.Join(undeclared, ", "),
+	}
+}
@@ -1,29 +1,130 @@
 package openapi3middleware
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
 )
 
-func newBufferingResponseWriter(rw http.ResponseWriter) *bufferingResponseWriter {
-	return &bufferingResponseWriter{rw: rw, buf: new(bytes.Buffer)}
+// BufferingResponseWriter is an http.ResponseWriter that holds the response written by the handler until it is validated.
+//
+// The implementation that wraps the one returned by NewBufferingResponseWriter should embed it,
+// so that the methods below that WithResponseValidation and http.ResponseController rely on are forwarded.
+type BufferingResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+	// Close releases the resources that hold the body such as the temporary file.
+	// WithResponseValidation calls it after the response is sent.
+	io.Closer
+	// Hijacked reports whether the connection has been hijacked.
+	// WithResponseValidation gives up validating the response if it returns true.
+	Hijacked() bool
+	// Unwrap returns the original http.ResponseWriter for http.ResponseController.
+	Unwrap() http.ResponseWriter
+	// StatusCode returns the status code written by the handler, or zero if it has not been written.
+	StatusCode() int
+	// Body returns a reader that reads the buffered body from the beginning.
+	Body() (io.Reader, error)
+	// BodySize returns the size in bytes of the buffered body.
+	BodySize() int64
+	// Emit sends the buffered response to the original http.ResponseWriter.
+	Emit()
+}
+
+// NewBufferingResponseWriter returns the BufferingResponseWriter that WithResponseValidation uses by default.
+//
+// It is intended to be wrapped by the implementation that MiddlewareOptions.ResponseWriterFactory returns.
+func NewBufferingResponseWriter(rw http.ResponseWriter) BufferingResponseWriter {
+	return newBufferingResponseWriter(rw, 0)
+}
+
+func newBufferingResponseWriter(rw http.ResponseWriter, spillThreshold int64) *bufferingResponseWriter {
+	return &bufferingResponseWriter{rw: rw, buf: new(bytes.Buffer), spillThreshold: spillThreshold}
 }
 
 type bufferingResponseWriter struct {
-	buf        *bytes.Buffer
-	rw         http.ResponseWriter
-	statusCode int
+	buf            *bytes.Buffer
+	rw             http.ResponseWriter
+	status         int
+	spillThreshold int64
+	spilled        *os.File
+	size           int64
+	detached       bool
+}
+
+var _ BufferingResponseWriter = &bufferingResponseWriter{}
+
+func (rw *bufferingResponseWriter) Emit() {
+	body, err := rw.Body()
+	if err != nil {
+		return
+	}
+	if rw.status != 0 {
+		rw.rw.WriteHeader(rw.status)
+	}
+	_, _ = io.Copy(rw.rw, body)
+}
+
+func (rw *bufferingResponseWriter) StatusCode() int {
+	return rw.status
+}
+
+func (rw *bufferingResponseWriter) BodySize() int64 {
+	return rw.size
+}
+
+func (rw *bufferingResponseWriter) Body() (io.Reader, error) {
+	if rw.spilled == nil {
+		return bytes.NewReader(rw.buf.Bytes()), nil
+	}
+	if _, err := rw.spilled.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return rw.spilled, nil
+}
+
+// spill moves the buffered body to a temporary file and makes subsequent writes go to the file.
+func (rw *bufferingResponseWriter) spill() error {
+	f, err := os.CreateTemp("", "openapi3middleware-response-*")
+	if err != nil {
+		return err
+	}
+	rw.spilled = f
+	_, err = rw.buf.WriteTo(f)
+	return err
 }
 
-func (rw *bufferingResponseWriter) emit() {
-	if rw.statusCode != 0 {
-		rw.rw.WriteHeader(rw.statusCode)
+// Close removes the temporary file if the body has been spilled.
+func (rw *bufferingResponseWriter) Close() error {
+	if rw.spilled == nil {
+		return nil
 	}
-	_, _ = rw.buf.WriteTo(rw.rw)
+	_ = rw.spilled.Close()
+	return os.Remove(rw.spilled.Name())
 }
 
 func (rw *bufferingResponseWriter) Write(b []byte) (int, error) {
-	return rw.buf.Write(b)
+	if rw.spilled == nil && rw.spillThreshold > 0 && int64(rw.buf.Len()+len(b)) > rw.spillThreshold {
+		if err := rw.spill(); err != nil {
+			return 0, err
+		}
+	}
+	var (
+		n   int
+		err error
+	)
+	if rw.spilled != nil {
+		n, err = rw.spilled.Write(b)
+	} else {
+		n, err = rw.buf.Write(b)
+	}
+	rw.size += int64(n)
+	return n, err
 }
 
 func (rw *bufferingResponseWriter) Header() http.Header {
@@ -31,5 +132,37 @@ func (rw *bufferingResponseWriter) Header() http.Header {
 }
 
 func (rw *bufferingResponseWriter) WriteHeader(statusCode int) {
-	rw.statusCode = statusCode
+	rw.status = statusCode
+}
+
+// Flush does nothing because the response must be held until it is validated.
+// It lets http.ResponseController.Flush succeed without sending the unvalidated response.
+func (rw *bufferingResponseWriter) Flush() {}
+
+// Unwrap returns the original http.ResponseWriter for http.ResponseController.
+func (rw *bufferingResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.rw
+}
+
+// Hijack sends the response buffered so far and lets the caller take over the connection.
+// The response of the hijacked connection is not validated.
+func (rw *bufferingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rw.rw.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T does not implement http.Hijacker", rw.rw)
+	}
+	if rw.status != 0 || rw.size > 0 {
+		rw.Emit()
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	rw.detached = true
+	return conn, brw, nil
+}
+
+// Hijacked reports whether the connection has been hijacked.
+func (rw *bufferingResponseWriter) Hijacked() bool {
+	return rw.detached
 }
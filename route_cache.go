@@ -0,0 +1,97 @@
+package openapi3middleware
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+
+	"github.com/getkin/kin-openapi/routers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type routeCacheKey struct{}
+
+// cachedRoute is the result of finding the route that every layer shares for the same request.
+type cachedRoute struct {
+	resolved   bool
+	router     routers.Router
+	method     string
+	path       string
+	route      *routers.Route
+	pathParams map[string]string
+	err        error
+}
+
+// withRouteCache returns the context that holds the route found for the request.
+// The context that already holds one is returned as it is so that every layer shares it.
+func withRouteCache(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(routeCacheKey{}).(*cachedRoute); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, routeCacheKey{}, new(cachedRoute))
+}
+
+// RouteFromContext returns the route of the request that the middleware has found.
+//
+// The next handler of WithRequestValidation and WithResponseValidation can get the route from the context of the request.
+func RouteFromContext(ctx context.Context) (*routers.Route, bool) {
+	cache, ok := ctx.Value(routeCacheKey{}).(*cachedRoute)
+	if !ok || cache.route == nil {
+		return nil, false
+	}
+	return cache.route, true
+}
+
+// findRoute is the single resolver of the route of the request.
+//
+// It reuses the result that another layer has resolved for the same request if it is cached,
+// and records the route on the span of the context of the request.
+func findRoute(router routers.Router, r *http.Request) (*routers.Route, map[string]string, error) {
+	cache, ok := r.Context().Value(routeCacheKey{}).(*cachedRoute)
+	if ok && cache.resolved && cache.method == r.Method && cache.path == r.URL.Path && sameRouter(cache.router, router) {
+		if cache.err != nil {
+			return nil, nil, cache.err
+		}
+		recordRoute(trace.SpanFromContext(r.Context()), cache.route)
+		return cache.route, copyPathParams(cache.pathParams), nil
+	}
+	route, pathParams, err := router.FindRoute(r)
+	if ok {
+		*cache = cachedRoute{resolved: true, router: router, method: r.Method, path: r.URL.Path, route: route, pathParams: copyPathParams(pathParams), err: err}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	recordRoute(trace.SpanFromContext(r.Context()), route)
+	return route, pathParams, nil
+}
+
+func recordRoute(span trace.Span, route *routers.Route) {
+	if route == nil {
+		return
+	}
+	attrs := []attribute.KeyValue{attribute.String("http.route", route.Path)}
+	if route.Operation != nil && route.Operation.OperationID != "" {
+		attrs = append(attrs, attribute.String("openapi.operation_id", route.Operation.OperationID))
+	}
+	span.SetAttributes(attrs...)
+}
+
+func sameRouter(a, b routers.Router) bool {
+	if a == nil || b == nil || !reflect.TypeOf(a).Comparable() || !reflect.TypeOf(b).Comparable() {
+		return false
+	}
+	return a == b
+}
+
+func copyPathParams(pathParams map[string]string) map[string]string {
+	if pathParams == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(pathParams))
+	for k, v := range pathParams {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,219 @@
+package openapi3middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+const maxSampleDepth = 32
+
+// SampleResponse returns the minimal body of the response of the route that satisfies the schema of the status and the content type.
+//
+// The example of the media type or the schema is used if it is given.
+// Otherwise the body is built from the defaults, the first values of the enums and the zero values that satisfy the constraints of the schema.
+// Only the required properties of the objects are filled.
+// It returns an error if the spec does not declare the response, or the schema has constraints that cannot be satisfied automatically such as pattern.
+func SampleResponse(route *routers.Route, status int, contentType string) ([]byte, error) {
+	if route == nil || route.Operation == nil || route.Operation.Responses == nil {
+		return nil, fmt.Errorf("the route has no responses")
+	}
+	responses := route.Operation.Responses
+	responseRef := responses.Status(status)
+	if responseRef == nil {
+		responseRef = responses.Default()
+	}
+	if responseRef == nil || responseRef.Value == nil {
+		return nil, fmt.Errorf("the response of status %d is not declared", status)
+	}
+	mt := responseRef.Value.Content.Get(contentType)
+	if mt == nil {
+		return nil, fmt.Errorf("the content of %q is not declared in the response of status %d", contentType, status)
+	}
+	var (
+		value interface{}
+		err   error
+	)
+	switch {
+	case mt.Example != nil:
+		value = mt.Example
+	case len(mt.Examples) > 0:
+		value = firstExample(mt.Examples)
+	case mt.Schema != nil && mt.Schema.Value != nil:
+		value, err = sampleValue(mt.Schema.Value, 0)
+	default:
+		return nil, fmt.Errorf("the content of %q has no schema", contentType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !isJSONMediaType(contentType) {
+		if s, ok := value.(string); ok {
+			return []byte(s), nil
+		}
+		return nil, fmt.Errorf("cannot encode the sample of %q", contentType)
+	}
+	return json.Marshal(value)
+}
+
+func firstExample(examples openapi3.Examples) interface{} {
+	names := make([]string, 0, len(examples))
+	for name := range examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ex := examples[name]; ex != nil && ex.Value != nil {
+			return ex.Value.Value
+		}
+	}
+	return nil
+}
+
+func sampleValue(schema *openapi3.Schema, depth int) (interface{}, error) {
+	if depth > maxSampleDepth {
+		return nil, fmt.Errorf("the schema is too deep to sample")
+	}
+	switch {
+	case schema.Example != nil:
+		return schema.Example, nil
+	case schema.Default != nil:
+		return schema.Default, nil
+	case len(schema.Enum) > 0:
+		return schema.Enum[0], nil
+	}
+	if len(schema.AllOf) > 0 {
+		return sampleAllOf(schema, depth)
+	}
+	for _, branches := range []openapi3.SchemaRefs{schema.OneOf, schema.AnyOf} {
+		if len(branches) > 0 && branches[0].Value != nil {
+			return sampleValue(branches[0].Value, depth+1)
+		}
+	}
+	switch schema.Type {
+	case openapi3.TypeObject, "":
+		if schema.Type == "" && len(schema.Properties) == 0 {
+			return map[string]interface{}{}, nil
+		}
+		return sampleObject(schema, depth)
+	case openapi3.TypeArray:
+		items := make([]interface{}, 0, schema.MinItems)
+		for i := uint64(0); i < schema.MinItems; i++ {
+			if schema.Items == nil || schema.Items.Value == nil {
+				items = append(items, nil)
+				continue
+			}
+			item, err := sampleValue(schema.Items.Value, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case openapi3.TypeString:
+		return sampleString(schema)
+	case openapi3.TypeInteger, openapi3.TypeNumber:
+		return sampleNumber(schema), nil
+	case openapi3.TypeBoolean:
+		return false, nil
+	default:
+		return nil, fmt.Errorf("cannot sample the value of type %q", schema.Type)
+	}
+}
+
+func sampleObject(schema *openapi3.Schema, depth int) (map[string]interface{}, error) {
+	obj := map[string]interface{}{}
+	for _, name := range schema.Required {
+		prop := schema.Properties[name]
+		if prop == nil || prop.Value == nil {
+			obj[name] = nil
+			continue
+		}
+		v, err := sampleValue(prop.Value, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("property %q: %w", name, err)
+		}
+		obj[name] = v
+	}
+	return obj, nil
+}
+
+func sampleAllOf(schema *openapi3.Schema, depth int) (interface{}, error) {
+	merged := map[string]interface{}{}
+	for _, branch := range schema.AllOf {
+		if branch.Value == nil {
+			continue
+		}
+		v, err := sampleValue(branch.Value, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return v, nil
+		}
+		for k, pv := range obj {
+			merged[k] = pv
+		}
+	}
+	return merged, nil
+}
+
+func sampleString(schema *openapi3.Schema) (string, error) {
+	if schema.Pattern != "" {
+		return "", fmt.Errorf("cannot sample the string that matches the pattern %q without an example", schema.Pattern)
+	}
+	var s string
+	switch schema.Format {
+	case "date-time":
+		s = "1970-01-01T00:00:00Z"
+	case "date":
+		s = "1970-01-01"
+	case "email":
+		s = "user@example.com"
+	case "uri", "url":
+		s = "https://example.com/"
+	case "uuid":
+		s = "00000000-0000-0000-0000-000000000000"
+	case "ipv4":
+		s = "127.0.0.1"
+	case "ipv6":
+		s = "::1"
+	}
+	if n := int(schema.MinLength); len(s) < n {
+		s += strings.Repeat("a", n-len(s))
+	}
+	return s, nil
+}
+
+func sampleNumber(schema *openapi3.Schema) interface{} {
+	if schema.Min == nil {
+		if schema.Max != nil && *schema.Max < 0 {
+			return sampleBound(schema, *schema.Max, schema.ExclusiveMax, -1)
+		}
+		return 0
+	}
+	return sampleBound(schema, *schema.Min, schema.ExclusiveMin, 1)
+}
+
+func sampleBound(schema *openapi3.Schema, bound float64, exclusive bool, direction float64) interface{} {
+	if schema.Type == openapi3.TypeInteger {
+		v := math.Ceil(bound)
+		if direction < 0 {
+			v = math.Floor(bound)
+		}
+		if exclusive && v == bound {
+			v += direction
+		}
+		return int64(v)
+	}
+	if exclusive {
+		return bound + direction
+	}
+	return bound
+}
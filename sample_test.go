@@ -0,0 +1,90 @@
+package openapi3middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+func TestSampleResponse(t *testing.T) {
+	route, _, err := router.FindRoute(mustRequest(http.NewRequest(http.MethodGet, "/users/123", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := SampleResponse(route, http.StatusOK, "application/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(got, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"id": "", "name": "", "age": float64(0)}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("sample: got=%v expected=%v", decoded, want)
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("content-type", "application/json")
+		_, _ = w.Write(got)
+	})
+	srv := httptest.NewServer(WithResponseValidation(MiddlewareOptions{Router: router})(handler))
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/users/123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestSampleResponse_schemas(t *testing.T) {
+	min := float64(3)
+	testCases := []struct {
+		name    string
+		schema  *openapi3.Schema
+		example interface{}
+		want    string
+		wantErr bool
+	}{
+		{name: "media type example", schema: openapi3.NewStringSchema(), example: "hello", want: `"hello"`},
+		{name: "default", schema: openapi3.NewStringSchema().WithDefault("anonymous"), want: `"anonymous"`},
+		{name: "enum", schema: openapi3.NewStringSchema().WithEnum("free", "premium"), want: `"free"`},
+		{name: "minimum", schema: &openapi3.Schema{Type: openapi3.TypeInteger, Min: &min, ExclusiveMin: true}, want: `4`},
+		{name: "min length", schema: openapi3.NewStringSchema().WithMinLength(2), want: `"aa"`},
+		{name: "min items", schema: openapi3.NewArraySchema().WithItems(openapi3.NewBoolSchema()).WithMinItems(2), want: `[false,false]`},
+		{name: "pattern", schema: openapi3.NewStringSchema().WithPattern("^[0-9]+$"), wantErr: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mt := openapi3.NewMediaType().WithSchema(tc.schema)
+			mt.Example = tc.example
+			response := openapi3.NewResponse().WithContent(openapi3.Content{"application/json": mt})
+			route := &routers.Route{Operation: &openapi3.Operation{Responses: openapi3.NewResponses(openapi3.WithStatus(http.StatusOK, &openapi3.ResponseRef{Value: response}))}}
+			got, err := SampleResponse(route, http.StatusOK, "application/json")
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected an error but got %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("sample: got=%s expected=%s", got, tc.want)
+			}
+		})
+	}
+	if _, err := SampleResponse(&routers.Route{Operation: &openapi3.Operation{Responses: openapi3.NewResponses()}}, http.StatusNotFound, "application/json"); err == nil {
+		t.Error("expected an error for the undeclared response")
+	}
+}
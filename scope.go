@@ -0,0 +1,97 @@
+package openapi3middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// InsufficientScopeError means the granted scopes lack some of the scopes that the security requirement requires.
+type InsufficientScopeError struct {
+	SecuritySchemeName string
+	Required           []string
+	Granted            []string
+	Missing            []string
+}
+
+func (e *InsufficientScopeError) Error() string {
+	return fmt.Sprintf("security requirement %q lacks scopes: %s", e.SecuritySchemeName, strings.Join(e.Missing, ", "))
+}
+
+// RequireScopes returns the error of the authentication if the granted scopes lack some of the scopes that the security requirement of input requires.
+//
+// It is intended to be called in openapi3filter.Options.AuthenticationFunc with the scopes granted to the credential of the request.
+// The error is reported with 403 Forbidden by the default reporter of request validation errors.
+func RequireScopes(input *openapi3filter.AuthenticationInput, granted []string) error {
+	grantedSet := make(map[string]bool, len(granted))
+	for _, scope := range granted {
+		grantedSet[scope] = true
+	}
+	var missing []string
+	for _, scope := range input.Scopes {
+		if !grantedSet[scope] {
+			missing = append(missing, scope)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return input.NewError(&InsufficientScopeError{
+		SecuritySchemeName: input.SecuritySchemeName,
+		Required:           input.Scopes,
+		Granted:            granted,
+		Missing:            missing,
+	})
+}
+
+// AsInsufficientScopeError finds InsufficientScopeError in err including the errors of openapi3filter.SecurityRequirementsError.
+func AsInsufficientScopeError(err error) (*InsufficientScopeError, bool) {
+	switch err := err.(type) {
+	case nil:
+		return nil, false
+	case *InsufficientScopeError:
+		return err, true
+	case *openapi3filter.SecurityRequirementsError:
+		for _, child := range err.Errors {
+			if scopeErr, ok := AsInsufficientScopeError(child); ok {
+				return scopeErr, true
+			}
+		}
+		return nil, false
+	case openapi3.MultiError:
+		for _, child := range err {
+			if scopeErr, ok := AsInsufficientScopeError(child); ok {
+				return scopeErr, true
+			}
+		}
+		return nil, false
+	default:
+		return AsInsufficientScopeError(errors.Unwrap(err))
+	}
+}
+
+// ReportInsufficientScope responds 403 Forbidden that lists the missing scopes if err has InsufficientScopeError.
+// It reports whether it responded so that the custom reporters can fall back on the other responses.
+func ReportInsufficientScope(w http.ResponseWriter, err error) bool {
+	return reportInsufficientScope(w, err, nil)
+}
+
+func reportInsufficientScope(w http.ResponseWriter, err error, extra map[string]interface{}) bool {
+	scopeErr, ok := AsInsufficientScopeError(err)
+	if !ok {
+		return false
+	}
+	w.Header().Set("www-authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopeErr.Required, " ")))
+	rpt := &report{
+		Reason:        scopeErr.Error(),
+		Code:          ErrorCodeInsufficientScope,
+		Field:         "security",
+		MissingScopes: scopeErr.Missing,
+	}
+	_ = respondJSON(w, http.StatusForbidden, withExtra(rootError{Error: errorAggregate{Request: rpt}}, extra))
+	return true
+}
@@ -0,0 +1,65 @@
+package openapi3middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+func TestRequireScopes(t *testing.T) {
+	testCases := []struct {
+		name           string
+		granted        string
+		wantStatus     int
+		wantBody       string
+		wantAuthHeader string
+	}{
+		{name: "granted", granted: "admin reports:read", wantStatus: http.StatusOK},
+		{
+			name:           "missing scope",
+			granted:        "reports:read",
+			wantStatus:     http.StatusForbidden,
+			wantBody:       `{"error":{"request":{"reason":"security requirement \"oauth\" lacks scopes: admin","code":"INSUFFICIENT_SCOPE","field":"security","value":null,"schema":null,"missingScopes":["admin"]}}}` + "\n",
+			wantAuthHeader: `Bearer error="insufficient_scope", scope="reports:read admin"`,
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			options := &openapi3filter.Options{
+				AuthenticationFunc: func(_ context.Context, input *openapi3filter.AuthenticationInput) error {
+					granted := strings.Fields(input.RequestValidationInput.Request.Header.Get("x-granted-scopes"))
+					return RequireScopes(input, granted)
+				},
+			}
+			mw := WithRequestValidation(MiddlewareOptions{Router: router, ValidationOptions: options})
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(http.MethodGet, srv.URL+"/reports", map[string]string{"x-granted-scopes": tc.granted}, "")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantBody != "" && string(body) != tc.wantBody {
+				t.Errorf("body:\n got=%s\nwant=%s", body, tc.wantBody)
+			}
+			if got := resp.Header.Get("www-authenticate"); got != tc.wantAuthHeader {
+				t.Errorf("WWW-Authenticate: got=%q expected=%q", got, tc.wantAuthHeader)
+			}
+		})
+	}
+}
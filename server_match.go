@@ -0,0 +1,63 @@
+package openapi3middleware
+
+import (
+	"fmt"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// ServerMatchMode controls how the router matches the requests with the servers declared in the document.
+type ServerMatchMode int
+
+const (
+	// MatchServers routes the requests only if they match the servers of the document.
+	MatchServers ServerMatchMode = iota
+	// IgnoreServers routes the requests purely with their paths and methods regardless of the servers.
+	// The paths of the requests must not have the base paths of the servers.
+	// It is intended for the tests that send requests to the server with a random address such as httptest.Server.
+	IgnoreServers
+)
+
+func (m ServerMatchMode) String() string {
+	switch m {
+	case MatchServers:
+		return "MatchServers"
+	case IgnoreServers:
+		return "IgnoreServers"
+	default:
+		return "ServerMatchMode(unknown)"
+	}
+}
+
+// NewRouter returns the router built with gorillamux that matches the servers in mode.
+func NewRouter(doc *openapi3.T, mode ServerMatchMode) (routers.Router, error) {
+	if mode == IgnoreServers {
+		doc = withoutServers(doc)
+	}
+	r, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("gorillamux.NewRouter: %w", err)
+	}
+	return r, nil
+}
+
+// withoutServers returns the shallow copy of doc that the servers of the document, the paths and the operations are removed from.
+func withoutServers(doc *openapi3.T) *openapi3.T {
+	copied := *doc
+	copied.Servers = nil
+	paths := openapi3.NewPaths()
+	for path, pathItem := range doc.Paths.Map() {
+		item := *pathItem
+		item.Servers = nil
+		for method, op := range pathItem.Operations() {
+			copiedOp := *op
+			copiedOp.Servers = nil
+			item.SetOperation(method, &copiedOp)
+		}
+		paths.Set(path, &item)
+	}
+	copied.Paths = paths
+	return &copied
+}
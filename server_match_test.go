@@ -0,0 +1,43 @@
+package openapi3middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestFromFSWithServerMatchMode(t *testing.T) {
+	testCases := []struct {
+		name       string
+		mode       ServerMatchMode
+		path       string
+		wantStatus int
+	}{
+		{name: "match servers/random host", mode: MatchServers, path: "/ping?count=1", wantStatus: http.StatusInternalServerError},
+		{name: "ignore servers/ok", mode: IgnoreServers, path: "/ping?count=1", wantStatus: http.StatusOK},
+		{name: "ignore servers/operation servers", mode: IgnoreServers, path: "/status", wantStatus: http.StatusOK},
+		{name: "ignore servers/request error", mode: IgnoreServers, path: "/ping?count=abc", wantStatus: http.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := FromFSWithServerMatchMode(os.DirFS("testdata"), "fixed-server.openapi.json", tc.mode, MiddlewareOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+			defer srv.Close()
+			resp, err := srv.Client().Get(srv.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
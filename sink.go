@@ -0,0 +1,112 @@
+package openapi3middleware
+
+import (
+	"context"
+	"sync"
+
+	"github.com/getkin/kin-openapi/routers"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ValidationPhase is the phase of the validation that failed.
+type ValidationPhase string
+
+const (
+	PhaseFindRoute ValidationPhase = "find_route"
+	PhaseRequest   ValidationPhase = "request"
+	PhaseResponse  ValidationPhase = "response"
+)
+
+// ValidationResult describes a validation failure.
+type ValidationResult struct {
+	Phase  ValidationPhase
+	Method string
+	Path   string
+	// Route is the matched route. It is nil if the route is not found.
+	Route *routers.Route
+	Err   error
+	// Observed reports whether the failure is only observed in Observe mode and the request or the response is passed through.
+	Observed bool
+	// RequestErr is the failure of the request validation observed for the same request.
+	// It is set on the result of PhaseResponse so that both failures are delivered together.
+	RequestErr error
+}
+
+// ErrorSink delivers validation failures to a function in a background goroutine,
+// independent of the error responses.
+//
+// The failures are dropped if the buffer is full so that the sink never delays responses.
+type ErrorSink struct {
+	fn     func(ctx context.Context, result ValidationResult)
+	ch     chan sinkItem
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+type sinkItem struct {
+	spanContext trace.SpanContext
+	result      ValidationResult
+}
+
+// NewErrorSink returns a new ErrorSink that calls fn for each failure with the buffer of bufferSize failures.
+//
+// It starts a goroutine that runs until Shutdown is called.
+func NewErrorSink(fn func(ctx context.Context, result ValidationResult), bufferSize int) *ErrorSink {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &ErrorSink{
+		fn:     fn,
+		ch:     make(chan sinkItem, bufferSize),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go s.run()
+	return s
+}
+
+func (s *ErrorSink) run() {
+	defer close(s.done)
+	for item := range s.ch {
+		s.fn(trace.ContextWithSpanContext(s.ctx, item.spanContext), item.result)
+	}
+}
+
+// Send enqueues the failure without blocking.
+// It reports whether the failure is accepted; the failure is dropped if the buffer is full or the sink has been shut down.
+func (s *ErrorSink) Send(ctx context.Context, result ValidationResult) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return false
+	}
+	select {
+	case s.ch <- sinkItem{spanContext: trace.SpanContextFromContext(ctx), result: result}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shutdown stops accepting failures and waits for the buffered failures to be delivered.
+//
+// If ctx is done before that, it cancels the context passed to the function and returns ctx.Err().
+func (s *ErrorSink) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.ch)
+	}
+	s.mu.Unlock()
+	select {
+	case <-s.done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,100 @@
+package openapi3middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+func TestWithValidation_asyncErrorSink(t *testing.T) {
+	testCases := []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		wantPhase ValidationPhase
+	}{
+		{name: "request error", method: http.MethodPost, path: "/users", body: `{"name":"aereal","age":"abc"}`, wantPhase: PhaseRequest},
+		{name: "response error", method: http.MethodGet, path: "/users/123", wantPhase: PhaseResponse},
+		{name: "find route error", method: http.MethodGet, path: "/unknown", wantPhase: PhaseFindRoute},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			release := make(chan struct{})
+			received := make(chan ValidationResult, 1)
+			sink := NewErrorSink(func(ctx context.Context, result ValidationResult) {
+				<-release
+				received <- result
+			}, 1)
+			mw := WithValidation(MiddlewareOptions{Router: router, AsyncErrorSink: sink})
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("content-type", "application/json")
+				_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": "aereal", "age": 17})
+			})))
+			defer srv.Close()
+
+			// the response must be returned while the sink is blocked
+			resp, err := srv.Client().Do(mustRequest(newRequest(tc.method, srv.URL+tc.path, map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				t.Errorf("unexpected status code: %d", resp.StatusCode)
+			}
+			close(release)
+
+			select {
+			case result := <-received:
+				if result.Phase != tc.wantPhase {
+					t.Errorf("Phase: got=%s expected=%s", result.Phase, tc.wantPhase)
+				}
+				if result.Method != tc.method || result.Path != tc.path {
+					t.Errorf("request: got=%s %s expected=%s %s", result.Method, result.Path, tc.method, tc.path)
+				}
+				if result.Err == nil {
+					t.Error("Err is nil")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("the sink does not receive the failure")
+			}
+			if err := sink.Shutdown(context.Background()); err != nil {
+				t.Errorf("Shutdown: %v", err)
+			}
+		})
+	}
+}
+
+func TestErrorSink_Shutdown(t *testing.T) {
+	release := make(chan struct{})
+	sink := NewErrorSink(func(ctx context.Context, result ValidationResult) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+	}, 2)
+	result := ValidationResult{Phase: PhaseRequest, Err: &openapi3filter.RequestError{}}
+	if !sink.Send(context.Background(), result) {
+		t.Error("the first failure must be accepted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := sink.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown: got=%v expected=%v", err, context.DeadlineExceeded)
+	}
+	if sink.Send(context.Background(), result) {
+		t.Error("the failure sent after shutdown must be dropped")
+	}
+	close(release)
+	if err := sink.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown: %v", err)
+	}
+}
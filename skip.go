@@ -0,0 +1,92 @@
+package openapi3middleware
+
+import (
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// The reasons that MiddlewareOptions.OnValidationSkipped receives.
+const (
+	// SkipReasonPath means the request is outside the prefix given to OnlyUnder.
+	SkipReasonPath = "skip_path"
+	// SkipReasonStatusNotValidated means MiddlewareOptions.ValidateResponseStatuses does not validate the status of the response.
+	SkipReasonStatusNotValidated = "status_not_validated"
+	// SkipReasonNotModified means the response is replaced with 304 Not Modified by MiddlewareOptions.HandleConditionalRequests.
+	SkipReasonNotModified = "not_modified"
+	// SkipReasonHijacked means the handler hijacked the connection.
+	SkipReasonHijacked = "hijacked"
+	// SkipReasonResponseValidationDisabled means WithValidation does not validate the response because MiddlewareOptions.EnableResponseValidation points false.
+	SkipReasonResponseValidationDisabled = "response_validation_disabled"
+	// SkipReasonUndeclaredStatus means the spec declares neither the status of the response nor the default response,
+	// and openapi3filter.Options.IncludeResponseStatus is disabled.
+	SkipReasonUndeclaredStatus = "undeclared_status"
+	// SkipReasonUndeclaredContent means the response has the body though the spec declares no content of the response,
+	// so the body is not validated.
+	SkipReasonUndeclaredContent = "undeclared_content"
+)
+
+func (o MiddlewareOptions) skipped(r *http.Request, reason string) {
+	if f := o.OnValidationSkipped; f != nil {
+		f(r, reason)
+	}
+}
+
+// skipNotifier is implemented by the handlers that the middlewares of this package return,
+// so that OnlyUnder notifies MiddlewareOptions.OnValidationSkipped of the requests that bypass them.
+type skipNotifier interface {
+	notifyingSkipped(next http.Handler, reason string) http.Handler
+}
+
+type validatingHandler struct {
+	http.HandlerFunc
+	options MiddlewareOptions
+}
+
+var _ skipNotifier = &validatingHandler{}
+
+// validatingHandler returns the handler that validates with f and carries the options for OnlyUnder.
+func (o MiddlewareOptions) validatingHandler(f http.HandlerFunc) http.Handler {
+	return &validatingHandler{HandlerFunc: f, options: o}
+}
+
+func (h *validatingHandler) notifyingSkipped(next http.Handler, reason string) http.Handler {
+	return h.options.notifyingSkipped(next, reason)
+}
+
+// notifyingSkipped returns the handler that notifies OnValidationSkipped of the request with the reason and passes it to next.
+func (o MiddlewareOptions) notifyingSkipped(next http.Handler, reason string) http.Handler {
+	if o.OnValidationSkipped == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		o.skipped(r, reason)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// responseSkipReason returns the reason why openapi3filter.ValidateResponse passes the response without validating it, if any.
+func responseSkipReason(input *openapi3filter.ResponseValidationInput, bodySize int64) (string, bool) {
+	ri := input.RequestValidationInput
+	if ri.Route == nil || ri.Route.Operation == nil || ri.Request.Method == http.MethodHead {
+		return "", false
+	}
+	responses := ri.Route.Operation.Responses
+	if responses.Len() == 0 {
+		return "", false
+	}
+	ref := responses.Status(input.Status)
+	if ref == nil {
+		ref = responses.Default()
+	}
+	if ref == nil {
+		if opts := ri.Options; opts != nil && opts.IncludeResponseStatus {
+			return "", false
+		}
+		return SkipReasonUndeclaredStatus, true
+	}
+	if ref.Value != nil && len(ref.Value.Content) == 0 && bodySize > 0 {
+		return SkipReasonUndeclaredContent, true
+	}
+	return "", false
+}
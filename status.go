@@ -0,0 +1,69 @@
+package openapi3middleware
+
+import (
+	"net/http"
+)
+
+// Only2xx reports whether the status is successful.
+// It can be used as MiddlewareOptions.ValidateResponseStatuses to validate only the successful responses.
+func Only2xx(status int) bool {
+	return status >= 200 && status < 300
+}
+
+// isInformational reports whether the status is the informational one that precedes the final response.
+// 101 Switching Protocols is final because no other response follows it.
+func isInformational(status int) bool {
+	return status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+}
+
+// statusSelectingResponseWriter buffers the response only if its status is validated and sends the other responses directly.
+type statusSelectingResponseWriter struct {
+	BufferingResponseWriter
+	rw          http.ResponseWriter
+	validates   func(status int) bool
+	wroteHeader bool
+	bypassed    bool
+}
+
+func (w *statusSelectingResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	if isInformational(statusCode) {
+		// informational responses such as 103 Early Hints precede the final response that decides whether it is validated
+		w.rw.WriteHeader(statusCode)
+		return
+	}
+	w.wroteHeader = true
+	if !w.validates(statusCode) {
+		w.bypassed = true
+		w.rw.WriteHeader(statusCode)
+		return
+	}
+	w.BufferingResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusSelectingResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.bypassed {
+		return w.rw.Write(b)
+	}
+	return w.BufferingResponseWriter.Write(b)
+}
+
+// Flush sends the response written so far only if it is not validated.
+func (w *statusSelectingResponseWriter) Flush() {
+	if !w.bypassed {
+		return
+	}
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying BufferingResponseWriter for http.ResponseController.
+func (w *statusSelectingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.BufferingResponseWriter
+}
@@ -0,0 +1,132 @@
+package openapi3middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+)
+
+// checkStrictNumbers returns the error if the integers in the JSON request body overflow the formats (int32 and int64) declared in the schema.
+//
+// The body is decoded with json.Decoder.UseNumber so that the integers that lose precision as float64 are checked exactly.
+// Only the schemas reached through properties, additionalProperties, items and allOf are checked;
+// the branches of oneOf and anyOf are skipped because which of them the value matches is up to openapi3filter.
+func checkStrictNumbers(input *openapi3filter.RequestValidationInput) error {
+	op := input.Route.Operation
+	r := input.Request
+	if op == nil || op.RequestBody == nil || op.RequestBody.Value == nil || r.Body == nil {
+		return nil
+	}
+	contentType := r.Header.Get("content-type")
+	if !isJSONMediaType(contentType) {
+		return nil
+	}
+	mt := op.RequestBody.Value.Content.Get(contentType)
+	if mt == nil || mt.Schema == nil || mt.Schema.Value == nil {
+		return nil
+	}
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	setRequestBody(r, body)
+	if err != nil {
+		return &openapi3filter.RequestError{Input: input, RequestBody: op.RequestBody.Value, Reason: "failed to read the request body", Err: err}
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		// openapi3filter reports the malformed body
+		return nil
+	}
+	if schemaErr := checkIntegerFormats(mt.Schema.Value, value); schemaErr != nil {
+		return &openapi3filter.RequestError{Input: input, RequestBody: op.RequestBody.Value, Reason: "doesn't match schema", Err: schemaErr}
+	}
+	return nil
+}
+
+func checkIntegerFormats(schema *openapi3.Schema, value interface{}) *openapi3.SchemaError {
+	for _, sub := range schema.AllOf {
+		if sub.Value == nil {
+			continue
+		}
+		if err := checkIntegerFormats(sub.Value, value); err != nil {
+			return err
+		}
+	}
+	switch value := value.(type) {
+	case json.Number:
+		if schema.Type != openapi3.TypeInteger {
+			return nil
+		}
+		return checkIntegerFormat(schema, value)
+	case map[string]interface{}:
+		for name, prop := range value {
+			propSchema := schema.Properties[name]
+			if propSchema == nil && schema.AdditionalProperties.Schema != nil {
+				propSchema = schema.AdditionalProperties.Schema
+			}
+			if propSchema == nil || propSchema.Value == nil {
+				continue
+			}
+			if err := checkIntegerFormats(propSchema.Value, prop); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if schema.Items == nil || schema.Items.Value == nil {
+			return nil
+		}
+		for _, item := range value {
+			if err := checkIntegerFormats(schema.Items.Value, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkIntegerFormat(schema *openapi3.Schema, value json.Number) *openapi3.SchemaError {
+	var min, max int64
+	switch schema.Format {
+	case "int32":
+		min, max = math.MinInt32, math.MaxInt32
+	case "int64":
+		min, max = math.MinInt64, math.MaxInt64
+	default:
+		return nil
+	}
+	if n, err := strconv.ParseInt(value.String(), 10, 64); err == nil {
+		if min <= n && n <= max {
+			return nil
+		}
+	} else if inRange(value, min, max) {
+		return nil
+	}
+	return &openapi3.SchemaError{
+		Value:       value.String(),
+		Schema:      schema,
+		SchemaField: "format",
+		Reason:      fmt.Sprintf("number must be an %s", schema.Format),
+	}
+}
+
+// inRange reports whether the number written in the other forms than the integer literal, such as 1.0 and 1e3, is the integer between min and max.
+// The number that is not integral is left to openapi3filter.
+func inRange(value json.Number, min, max int64) bool {
+	f, _, err := big.ParseFloat(value.String(), 10, 256, big.ToNearestEven)
+	if err != nil {
+		return true
+	}
+	if !f.IsInt() {
+		return true
+	}
+	n, _ := f.Int(nil)
+	return n.Cmp(big.NewInt(min)) >= 0 && n.Cmp(big.NewInt(max)) <= 0
+}
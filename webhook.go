@@ -0,0 +1,67 @@
+package openapi3middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+)
+
+// WebhookRouter returns a router that routes requests to the operations of the webhook named webhookName.
+//
+// The webhook is looked up from the webhooks object introduced in OpenAPI 3.1.
+// The router matches requests only by the method and ignores the path, so it is intended to be passed to MiddlewareOptions
+// of the middleware that wraps the handler receiving the webhook.
+func WebhookRouter(doc *openapi3.T, webhookName string) (routers.Router, error) {
+	webhooks, _ := doc.Extensions["webhooks"].(map[string]interface{})
+	def, ok := webhooks[webhookName]
+	if !ok {
+		return nil, fmt.Errorf("webhook %q is not defined", webhookName)
+	}
+	encoded, err := json.Marshal(def)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %w", err)
+	}
+	pathItem := new(openapi3.PathItem)
+	if err := json.Unmarshal(encoded, pathItem); err != nil {
+		return nil, fmt.Errorf("json.Unmarshal: %w", err)
+	}
+	path := "/" + webhookName
+	// resolve references in the webhook against the components of the origin document
+	resolved := &openapi3.T{
+		OpenAPI:    doc.OpenAPI,
+		Info:       doc.Info,
+		Components: doc.Components,
+		Paths:      openapi3.NewPaths(openapi3.WithPath(path, pathItem)),
+	}
+	if err := openapi3.NewLoader().ResolveRefsIn(resolved, nil); err != nil {
+		return nil, fmt.Errorf("ResolveRefsIn: %w", err)
+	}
+	wr := &webhookRouter{routes: map[string]*routers.Route{}}
+	for method, op := range pathItem.Operations() {
+		wr.routes[method] = &routers.Route{
+			Spec:      doc,
+			Path:      path,
+			PathItem:  pathItem,
+			Method:    method,
+			Operation: op,
+		}
+	}
+	return wr, nil
+}
+
+type webhookRouter struct {
+	routes map[string]*routers.Route
+}
+
+var _ routers.Router = &webhookRouter{}
+
+func (wr *webhookRouter) FindRoute(r *http.Request) (*routers.Route, map[string]string, error) {
+	route, ok := wr.routes[r.Method]
+	if !ok {
+		return nil, nil, routers.ErrMethodNotAllowed
+	}
+	return route, map[string]string{}, nil
+}
@@ -0,0 +1,77 @@
+package openapi3middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestWebhookRouter(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromFile("./testdata/webhook.openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WebhookRouter(doc, "unknown"); err == nil {
+		t.Error("expected an error for the undefined webhook")
+	}
+	webhookRouter, err := WebhookRouter(doc, "userRegistered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "ok",
+			method:     http.MethodPost,
+			body:       `{"id":"123","name":"aereal","age":17}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "request error",
+			method:     http.MethodPost,
+			body:       `{"id":"123","name":"aereal","age":"abc"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `{"error":{"request":{"reason":"value must be an integer","code":"TYPE_MISMATCH","field":"type","value":"abc","schema":{"type":"integer"}}}}` + "\n",
+		},
+		{
+			name:       "method not allowed",
+			method:     http.MethodPut,
+			body:       `{"id":"123","name":"aereal","age":17}`,
+			wantStatus: http.StatusInternalServerError,
+			wantBody:   `{"Error":{"Message":"method not allowed","Kind":"*routers.RouteError"}}` + "\n",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mw := WithRequestValidation(MiddlewareOptions{Router: webhookRouter})
+			srv := httptest.NewServer(mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})))
+			defer srv.Close()
+			resp, err := srv.Client().Do(mustRequest(newRequest(tc.method, srv.URL+"/webhooks/receive", map[string]string{"content-type": "application/json"}, tc.body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus {
+				t.Errorf("StatusCode: got=%d expected=%d", resp.StatusCode, tc.wantStatus)
+			}
+			got, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.wantBody {
+				t.Errorf("body:\ngot=%s\nexpected=%s", got, tc.wantBody)
+			}
+		})
+	}
+}